@@ -0,0 +1,377 @@
+package uyaml
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PathBuilder composes paths from individual segments, escaping keys and
+// quoting values as required, so that arbitrary input can be safely used
+// within paths. PathBuilders are obtained through NewPath, and each of their
+// methods appends a segment to the receiver, returning the receiver itself:
+//
+//	path, err := uyaml.NewPath().Key("users").Where("name", name).Key("roles").Build()
+type PathBuilder struct {
+	path strings.Builder
+	err  error
+}
+
+// NewPath returns a new, empty PathBuilder
+func NewPath() *PathBuilder {
+	return &PathBuilder{}
+}
+
+// segment appends a dot-separated segment to the receiver
+func (b *PathBuilder) segment(s string) *PathBuilder {
+	if b.path.Len() > 0 {
+		b.path.WriteRune(dot)
+	}
+	b.path.WriteString(s)
+	return b
+}
+
+// bracket appends a bracketed segment to the receiver
+func (b *PathBuilder) bracket(s string) *PathBuilder {
+	b.path.WriteRune(leftBracket)
+	b.path.WriteString(s)
+	b.path.WriteRune(rightBracket)
+	return b
+}
+
+// Key appends a segment matching the provided mapping key
+func (b *PathBuilder) Key(key string) *PathBuilder {
+	return b.segment(EscapeKey(key))
+}
+
+// Index appends a segment matching the sequence item at the provided
+// position. Negative positions count from the end of the sequence.
+func (b *PathBuilder) Index(idx int) *PathBuilder {
+	return b.bracket(strconv.Itoa(idx))
+}
+
+// Slice appends a segment matching sequence items from start up to, but not
+// including, end.
+func (b *PathBuilder) Slice(start, end int) *PathBuilder {
+	return b.bracket(strconv.Itoa(start) + string(colon) + strconv.Itoa(end))
+}
+
+// SliceFrom appends a segment matching sequence items from start up to the
+// end of the sequence.
+func (b *PathBuilder) SliceFrom(start int) *PathBuilder {
+	return b.bracket(strconv.Itoa(start) + string(colon))
+}
+
+// SliceTo appends a segment matching sequence items from the beginning of the
+// sequence up to, but not including, end.
+func (b *PathBuilder) SliceTo(end int) *PathBuilder {
+	return b.bracket(string(colon) + strconv.Itoa(end))
+}
+
+// Wildcard appends a segment matching every value of a mapping, or every item
+// of a sequence.
+func (b *PathBuilder) Wildcard() *PathBuilder {
+	return b.segment(string(asterisk))
+}
+
+// Recursive appends a recursive descent segment, matching the current value
+// and all of its descendants.
+func (b *PathBuilder) Recursive() *PathBuilder {
+	return b.segment(string([]rune{asterisk, asterisk}))
+}
+
+// Union appends a segment matching the items matched by any of the provided
+// paths, each of them evaluated relative to the current item.
+func (b *PathBuilder) Union(branches ...*PathBuilder) *PathBuilder {
+	if len(branches) == 0 && b.err == nil {
+		b.err = fmt.Errorf("cannot create a union without branches")
+	}
+	parts := make([]string, 0, len(branches))
+	for _, br := range branches {
+		if br.err != nil && b.err == nil {
+			b.err = br.err
+		}
+		parts = append(parts, br.String())
+	}
+	return b.segment(string(leftBrace) + strings.Join(parts, string(comma)) + string(rightBrace))
+}
+
+// pseudo appends a positional pseudo-selector to the receiver
+func (b *PathBuilder) pseudo(s string) *PathBuilder {
+	b.path.WriteRune(colon)
+	b.path.WriteString(s)
+	return b
+}
+
+// First narrows the items matched by the previous segment to the first one.
+// When following a key or index, the items of the value it matches are
+// narrowed instead.
+func (b *PathBuilder) First() *PathBuilder {
+	return b.pseudo("first")
+}
+
+// Last narrows the items matched by the previous segment to the last one,
+// just like First.
+func (b *PathBuilder) Last() *PathBuilder {
+	return b.pseudo("last")
+}
+
+// Nth narrows the items matched by the previous segment to the one at the
+// provided 1-based position, just like First.
+func (b *PathBuilder) Nth(n int) *PathBuilder {
+	if n < 1 && b.err == nil {
+		b.err = fmt.Errorf("invalid position %d: positions start at 1", n)
+	}
+	return b.pseudo("nth(" + strconv.Itoa(n) + ")")
+}
+
+// Even narrows the items matched by the previous segment to the ones at even
+// 1-based positions, just like First.
+func (b *PathBuilder) Even() *PathBuilder {
+	return b.pseudo("even")
+}
+
+// Odd narrows the items matched by the previous segment to the ones at odd
+// 1-based positions, just like First.
+func (b *PathBuilder) Odd() *PathBuilder {
+	return b.pseudo("odd")
+}
+
+// function appends a function segment to the receiver
+func (b *PathBuilder) function(fn pathFunction) *PathBuilder {
+	return b.segment(string(fn) + "()")
+}
+
+// Length appends a segment returning the number of items of each matched
+// sequence or mapping, or the number of characters of each matched string.
+// No other segment can follow it.
+func (b *PathBuilder) Length() *PathBuilder {
+	return b.function(funcLength)
+}
+
+// Keys appends a segment returning the keys of each matched mapping, in
+// document order. No other segment can follow it.
+func (b *PathBuilder) Keys() *PathBuilder {
+	return b.function(funcKeys)
+}
+
+// Type appends a segment returning the name of the Kind of each matched
+// item. No other segment can follow it.
+func (b *PathBuilder) Type() *PathBuilder {
+	return b.function(funcType)
+}
+
+// Parent appends a segment matching the parent of each matched item. Parent
+// steps stop at the document's root.
+func (b *PathBuilder) Parent() *PathBuilder {
+	return b.segment(string(caret))
+}
+
+// Where appends a selector matching items holding value under the provided
+// key. It is a shorthand for Match(Eq(Field{key}, value)).
+func (b *PathBuilder) Where(key string, value interface{}) *PathBuilder {
+	return b.Match(Eq(Field{key}, value))
+}
+
+// Match appends a selector matching items satisfying the provided condition
+func (b *PathBuilder) Match(c Condition) *PathBuilder {
+	if c.err != nil && b.err == nil {
+		b.err = c.err
+	}
+	return b.segment(string(leftParen) + c.expr + string(rightParen))
+}
+
+// String returns the path composed by the receiver
+func (b *PathBuilder) String() string {
+	return b.path.String()
+}
+
+// Build returns the compiled path composed by the receiver. Returns an error
+// in case any of the provided conditions uses a value that cannot be
+// represented in a path, or in case the receiver is empty.
+func (b *PathBuilder) Build() (Path, error) {
+	if b.err != nil {
+		return Path{}, b.err
+	}
+	return CompilePath(b.String())
+}
+
+// MustBuild works just like Build, but panics in case an error occurs.
+func (b *PathBuilder) MustBuild() Path {
+	p, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Field identifies the value compared by a Condition, as a list of keys
+// leading to it from each item. An empty Field refers to the item itself.
+type Field []string
+
+func (f Field) String() string {
+	if len(f) == 0 {
+		return string(dot)
+	}
+	keys := make([]string, len(f))
+	for i, k := range f {
+		keys[i] = EscapeKey(k)
+	}
+	return strings.Join(keys, string(dot))
+}
+
+// Condition represents a condition used by selectors appended through
+// PathBuilder.Match. Conditions are obtained through functions such as Eq, Gt
+// and Exists, and can be combined through And, Or and Not.
+type Condition struct {
+	expr     string
+	compound bool
+	err      error
+}
+
+func compareCondition(f Field, op selectorOperator, value interface{}) Condition {
+	lit, err := selectorLiteral(value)
+	return Condition{expr: f.String() + op.String() + lit, err: err}
+}
+
+// selectorLiteral returns the representation of the provided value within a
+// selector. Strings are quoted, while numbers, booleans and nil are
+// represented by unquoted literals.
+func selectorLiteral(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return quoteString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int8:
+		return strconv.Itoa(int(v)), nil
+	case int16:
+		return strconv.Itoa(int(v)), nil
+	case int32:
+		return strconv.Itoa(int(v)), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float32:
+		return selectorFloat(float64(v), 32)
+	case float64:
+		return selectorFloat(v, 64)
+	}
+	return "", fmt.Errorf("cannot use value of type %T in a selector", value)
+}
+
+func selectorFloat(v float64, bitSize int) (string, error) {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return "", fmt.Errorf("cannot use %v in a selector", v)
+	}
+	s := strconv.FormatFloat(v, 'g', -1, bitSize)
+	if !strings.ContainsAny(s, ".eE") {
+		// Keep the literal parsed as a float
+		s += ".0"
+	}
+	return s, nil
+}
+
+// Eq returns a condition satisfied by items holding value under f
+func Eq(f Field, value interface{}) Condition {
+	return compareCondition(f, opEqual, value)
+}
+
+// Ne returns a condition satisfied by items not holding value under f
+func Ne(f Field, value interface{}) Condition {
+	return compareCondition(f, opNotEqual, value)
+}
+
+// Lt returns a condition satisfied by items holding a value lesser than the
+// provided one under f.
+func Lt(f Field, value interface{}) Condition {
+	return compareCondition(f, opLess, value)
+}
+
+// Le returns a condition satisfied by items holding a value lesser than or
+// equal to the provided one under f.
+func Le(f Field, value interface{}) Condition {
+	return compareCondition(f, opLessEqual, value)
+}
+
+// Gt returns a condition satisfied by items holding a value greater than the
+// provided one under f.
+func Gt(f Field, value interface{}) Condition {
+	return compareCondition(f, opGreater, value)
+}
+
+// Ge returns a condition satisfied by items holding a value greater than or
+// equal to the provided one under f.
+func Ge(f Field, value interface{}) Condition {
+	return compareCondition(f, opGreaterEqual, value)
+}
+
+// Matches returns a condition satisfied by items holding a value matching the
+// provided regular expression under f.
+func Matches(f Field, pattern string) Condition {
+	return compareCondition(f, opMatch, pattern)
+}
+
+// HasPrefix returns a condition satisfied by items holding a value starting
+// with prefix under f.
+func HasPrefix(f Field, prefix string) Condition {
+	return compareCondition(f, opPrefix, prefix)
+}
+
+// HasSuffix returns a condition satisfied by items holding a value ending with
+// suffix under f.
+func HasSuffix(f Field, suffix string) Condition {
+	return compareCondition(f, opSuffix, suffix)
+}
+
+// Contains returns a condition satisfied by items holding a value containing
+// substr under f.
+func Contains(f Field, substr string) Condition {
+	return compareCondition(f, opContains, substr)
+}
+
+// Exists returns a condition satisfied by items holding any value under f
+func Exists(f Field) Condition {
+	return Condition{expr: f.String()}
+}
+
+// Not returns a condition satisfied by items not satisfying c
+func Not(c Condition) Condition {
+	return Condition{expr: string(bang) + string(leftParen) + c.expr + string(rightParen), err: c.err}
+}
+
+// And returns a condition satisfied by items satisfying all of the provided
+// conditions.
+func And(conditions ...Condition) Condition {
+	return joinConditions(conditions, " && ")
+}
+
+// Or returns a condition satisfied by items satisfying any of the provided
+// conditions.
+func Or(conditions ...Condition) Condition {
+	return joinConditions(conditions, " || ")
+}
+
+func joinConditions(conditions []Condition, sep string) Condition {
+	result := Condition{compound: len(conditions) > 1}
+	parts := make([]string, 0, len(conditions))
+	for _, c := range conditions {
+		if c.err != nil && result.err == nil {
+			result.err = c.err
+		}
+		if c.compound {
+			parts = append(parts, string(leftParen)+c.expr+string(rightParen))
+		} else {
+			parts = append(parts, c.expr)
+		}
+	}
+	if len(parts) == 0 && result.err == nil {
+		result.err = fmt.Errorf("cannot combine an empty list of conditions")
+	}
+	result.expr = strings.Join(parts, sep)
+	return result
+}
@@ -2,31 +2,68 @@ package uyaml
 
 import (
 	"fmt"
-	"gopkg.in/yaml.v3"
 )
 
-func dig(path string, n *yaml.Node) (bool, *Element, error) {
+func dig(path string, from *Element, opts MatchOptions) (bool, *Element, error) {
 	if path == "" {
-		return false, nil, fmt.Errorf("empty path provided to DigItem")
+		return false, nil, fmt.Errorf("%w provided to DigItem", ErrEmptyPath)
 	}
 
-	ok, obj, err := search(path, n)
-	if !ok || err != nil {
-		return ok, nil, err
+	matches, err := search(path, from, opts)
+	if len(matches) == 0 || err != nil {
+		return false, nil, err
 	}
-	return ok, obj, err
+	return true, matches[0], nil
 }
 
-func mustDig(path string, n *yaml.Node) *Element {
+func digPath(p Path, from *Element, opts MatchOptions) (bool, *Element, error) {
+	if p.empty() {
+		return false, nil, fmt.Errorf("%w provided to DigPath", ErrEmptyPath)
+	}
+
+	matches := applySearch(p.components, from, opts)
+	if len(matches) == 0 {
+		return false, nil, nil
+	}
+	return true, matches[0], nil
+}
+
+func mustDig(path string, from *Element) *Element {
 	if path == "" {
-		panic("empty path provided to MustDigItem")
+		panic(fmt.Errorf("%w provided to MustDigItem", ErrEmptyPath))
 	}
-	ok, v, err := dig(path, n)
+	ok, v, err := dig(path, from, MatchOptions{})
 	if err != nil {
 		panic(err)
 	}
 	if !ok {
-		panic("item not found")
+		panic(fmt.Errorf("%w for path %s", ErrNotFound, path))
 	}
 	return v
 }
+
+func mustDigPath(p Path, from *Element) *Element {
+	ok, v, err := digPath(p, from, MatchOptions{})
+	if err != nil {
+		panic(err)
+	}
+	if !ok {
+		panic(fmt.Errorf("%w for path %s", ErrNotFound, p))
+	}
+	return v
+}
+
+func digAll(path string, from *Element, opts MatchOptions) ([]*Element, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w provided to DigAll", ErrEmptyPath)
+	}
+
+	return search(path, from, opts)
+}
+
+func digAllPath(p Path, from *Element, opts MatchOptions) ([]*Element, error) {
+	if p.empty() {
+		return nil, fmt.Errorf("%w provided to DigAllPath", ErrEmptyPath)
+	}
+	return applySearch(p.components, from, opts), nil
+}
@@ -37,10 +37,214 @@ In order to obtain roles for a user under the key 'josie', DigItem can be used:
 		fmt.Printf("%#v", item.([]interface{}))
 	}
 
+Items within sequences can also be addressed by their position, either using
+a numeric key or brackets. The following paths are equivalent:
+
+	users.0.roles.1
+	users[0].roles[1]
+
+Negative positions count from the end of the sequence, so users[-1] refers to
+the last user. Brackets also accept slices, which match several items at once:
+users[1:3] matches the second and third users, and roles[:2] matches the first
+two roles. When a path matches several items, DigItem returns the first one,
+and Set and Remove only change that one.
+
+An asterisk matches every value of a mapping, or every item of a sequence.
+DigAll returns all items matched by a path, so users.*.name yields the name of
+every user:
+
+	names, err := doc.DigAll("users.*.name")
+
+Two consecutive dots perform a recursive descent, matching the following
+component at any depth. For instance, spec..image matches every image key
+under spec, in document order. A double asterisk can be used to the same
+effect, including at the beginning of a path: **.image matches every image key
+in the document.
+
+Braces combine several branches, each of them a path of its own, matching
+the items matched by any of them in document order. Selectors separated by
+commas work the same way:
+
+	metadata.{name,namespace}
+	users.(name='josie'),(name='lester')
+
+Pseudo-selectors narrow the items matched by the previous segment according
+to their position: :first, :last, :nth(n), counting from 1, and :even and
+:odd, which keep the second, fourth, and so on, or the first, third, and so
+on. When following a key, they narrow the items of the value under that key:
+
+	users.(admin=true):first
+	users.0.roles:last
+	items:nth(3)
+
+Paths may end with a function, returning a computed value rather than the
+matched item: length() returns the number of items of a sequence or mapping,
+or the number of characters of a string, keys() returns the keys of a mapping
+in document order, and type() returns the name of the item's Kind. Results
+are regular elements, so accessors such as Int and StringSlice apply, but they
+cannot be changed or removed:
+
+	users.length()
+	spec.keys()
+	users.0.weight.type()
+
+A caret steps back to the parent of each matched item, which allows matching
+deep within a structure and then climbing back up. Parent steps stop at the
+document's root, and items reached from several matches are only returned
+once:
+
+	spec.containers.(image='nginx').^.^
+
+Aliases are followed transparently, so a path can reach into an anchored value
+through any alias referring to it. Values containing themselves through
+aliases are only traversed once by recursive descents, and cannot be
+converted by Map or Interface, which report them as not convertible.
+
+Merge keys (<<) are honoured by lookups, wildcards and conversions such as Map
+and Interface: merged entries appear as entries of the mapping itself, keys
+defined by the mapping override merged ones, and earlier sources in a merged
+sequence override later ones. Setting a merged key, or a value below it, first
+copies the merged entry into the mapping, leaving the merged source untouched,
+while removing it is not supported. Element.ResolveMerges replaces merge keys
+by copies of the entries they provide:
+
+	job := doc.MustDigItem("jobs.test")
+	job.ResolveMerges()
+
+Keys containing dots, parentheses or quotes can be quoted, either as a segment
+or within brackets, or have their special characters escaped with a
+backslash. The following paths are equivalent:
+
+	labels.'app.kubernetes.io/name'
+	labels["app.kubernetes.io/name"]
+	labels.app\.kubernetes\.io/name
+
+When building paths from arbitrary keys, EscapeKey returns a segment that
+always refers to the provided key.
+
+Selectors filter sequence items, or mapping values, by one of their keys.
+Besides equality, they support the != < <= > and >= operators. Values may be
+quoted strings or unquoted numbers; numbers are compared numerically, while
+quoted values are compared against the key's raw value, or lexicographically
+when ordering strings:
+
+	items.(priority<=3).name
+	users.(weight>1.0)
+	users.(name!='josie')
+
+Items lacking the key never satisfy a comparison, except for !=, which they
+always satisfy, so users.(admin!=true) selects the same items as
+users.(!(admin=true)).
+
+Unquoted true, false and null are also accepted, and only match values of the
+same type. Booleans also match YAML's alternative spellings, such as yes and
+off. Quoted values, on the other hand, match any value with the same
+representation, so (admin='true') matches both a boolean and a string:
+
+	users.(admin=true)
+	users.(manager=null)
+
+String values can also be matched using CSS-like operators: ~= matches a
+regular expression, ^= matches a prefix, $= matches a suffix, and *= matches
+any substring:
+
+	users.(name~='^jo')
+	users.(name$='ie')
+
+Conditions can be combined with && and ||, negated with !, and grouped using
+parentheses. && takes precedence over ||:
+
+	users.(name='josie' && admin='true')
+	users.((role='bot' || role='dummy') && !(name='lester'))
+
+A key without an operator tests whether the key exists, regardless of its
+value, and can be negated to select items lacking it:
+
+	users.(admin)
+	users.(!admin)
+
+The key on the left side of a condition can be a path itself, which is
+resolved relative to each item. In case it yields several values, the
+condition holds when any of them satisfies it:
+
+	items.(metadata.name='web').spec
+	items.(spec.containers.*.image='nginx')
+
+A single dot refers to the item itself, which allows selecting items of
+sequences holding scalars. As *= is read as an operator, keys such as roles.*
+are rejected right before an equal sign, where [*] must be used for wildcards
+instead:
+
+	users.(name='josie').roles.(.='bot')
+	users.(roles[*]='dummy')
+
+When applied to a mapping, selectors filter its values, and Element.Key
+returns the key each match is stored under:
+
+	matches, err := doc.DigAll("services.(replicas>1)")
+	for _, m := range matches {
+		_, name := m.Key()
+		fmt.Println(name)
+	}
+
+When Set needs to create an item for a selector, only equality conditions
+joined by && can be used, as they determine the new item's keys, creating any
+nested structure they describe. Values conflicting with those conditions are
+rejected. Existence tests cannot be used to create new items, while items
+selected by their own value are created from the value in the selector, which a
+non-null value being set must match. New mapping values cannot be created
+through selectors, as they lack a key.
+
 MustDigItem works just like DigItem, except it only have a single return value,
 and panics in case the item cannot be found or the provided path cannot be
 parsed.
 
+Paths can also be composed through NewPath, which escapes keys and quotes
+values as required, so arbitrary input can be used safely:
+
+	path, err := uyaml.NewPath().Key("users").Where("name", name).Key("roles").Build()
+	path, err := uyaml.NewPath().Key("users").
+		Match(uyaml.And(uyaml.Eq(uyaml.Field{"admin"}, true), uyaml.Gt(uyaml.Field{"weight"}, 1.0))).
+		Build()
+
+Paths used repeatedly can be parsed once through CompilePath, and evaluated
+through DigPath, DigAllPath, SetPath and RemovePath:
+
+	name := uyaml.MustCompilePath("users.(admin=true).name")
+	for _, doc := range docs {
+		ok, item, err := doc.DigPath(name)
+		...
+	}
+
+Keys are matched exactly by default. DigItemWith and DigAllWith take
+MatchOptions, which allow matching keys regardless of their case, or regardless
+of whether they are written in snake_case or camelCase, both in path segments
+and in the keys used by selectors. Keys matching exactly are preferred over
+other matches, and the document itself is left unchanged:
+
+	doc.DigItemWith("spec.maxRetries", uyaml.MatchOptions{CaseInsensitive: true, Normalize: uyaml.SnakeAndCamel})
+
+Locations exchanged with other tools as JSON Pointers (RFC 6901), such as
+/users/0/roles/1, can be used through DigPointer, SetPointer and RemovePointer.
+The - token appends to sequences, while positions more than MaxSequencePadding
+items past their end result in ErrOutOfRange. PointerToPath and PathToPointer
+convert between pointers and paths, so locations reported by JSON-based tools
+can be mapped back onto a document:
+
+	path, err := uyaml.PointerToPath("/labels/app.kubernetes.io~1name")
+
+Paths that cannot be parsed result in a *PathSyntaxError, which holds the
+path, the offset of the offending character, and the tokens expected at that
+position, if known.
+
+Other failures can be identified through errors.Is and errors.As: ErrNotFound
+is reported when no item matches a path, ErrEmptyPath when an empty path is
+provided, and ErrUnsupportedParent when an element cannot be removed or
+replaced from its parent. A *TypeMismatchError, holding the offending path
+along with the expected and actual Kinds, is reported when a value cannot
+hold the structure being set. Panics raised by Must helpers carry the same
+errors.
+
 Removing Values
 
 Removing values can be done with the Remove method, which takes a single path
@@ -53,6 +257,12 @@ object is returned.
 	}
 	doc, err := doc.Remove("users.(name='josie')")
 
+RemoveAll removes every item matched by a path, returning the removed values.
+In case any of them cannot be removed, an error is returned and the document is
+left untouched:
+
+	removed, err := doc.RemoveAll("users.(name='josie'),(name='lester')")
+
 Setting Values
 
 Set can be used to inject arbitrary values into the document's structure. For
@@ -76,5 +286,20 @@ Would print the following structure:
 	  - dummy
 	- name: dummy
 	  test: true
+
+Just like Remove, Set only replaces the first item matched by a path, and
+follows the first matching branch of unions, or their first branch, in case
+none matches.
+
+Setting a position past the end of a sequence extends it with null items. At
+most MaxSequencePadding null items are added; positions further away, as well as
+negative ones, result in ErrOutOfRange.
+
+Changes made by Set below an alias apply to the anchored value, and are
+visible through every alias referring to it. SetWith accepts SetOptions, whose
+AliasCopy mode replaces the alias by a copy of the anchored value before
+applying changes, leaving the original untouched:
+
+	val, err := data.SetWith("jobs.0.spec.image", "envoy", uyaml.SetOptions{Aliases: uyaml.AliasCopy})
 */
 package uyaml
@@ -12,31 +12,96 @@ type Document struct {
 
 // DigItem attempts to retrieve an item in the provided path. Returns
 // a boolean indicating if an item was found, the found item, or an error,
-// if parsing the provided path fails.
+// if parsing the provided path fails. In case the path matches several items,
+// the first one is returned.
 func (y Document) DigItem(path string) (ok bool, val *Element, err error) {
-	return dig(path, y.Value)
+	return dig(path, rootElement(y.Value), MatchOptions{})
+}
+
+// DigAll retrieves all items matching the provided path, in document order.
+// Returns an empty slice in case no item matches the path, or an error, if
+// parsing the provided path fails.
+func (y Document) DigAll(path string) ([]*Element, error) {
+	return digAll(path, rootElement(y.Value), MatchOptions{})
 }
 
 // MustDigItem works just like DigItem, but panics in case the provided path
 // can't be parsed or in case an item cannot be retrieved.
 func (y Document) MustDigItem(path string) *Element {
-	return mustDig(path, y.Value)
+	return mustDig(path, rootElement(y.Value))
+}
+
+// DigPath works just like DigItem, but takes a compiled Path.
+func (y Document) DigPath(path Path) (ok bool, val *Element, err error) {
+	return digPath(path, rootElement(y.Value), MatchOptions{})
+}
+
+// DigAllPath works just like DigAll, but takes a compiled Path.
+func (y Document) DigAllPath(path Path) ([]*Element, error) {
+	return digAllPath(path, rootElement(y.Value), MatchOptions{})
+}
+
+// MustDigPath works just like MustDigItem, but takes a compiled Path.
+func (y Document) MustDigPath(path Path) *Element {
+	return mustDigPath(path, rootElement(y.Value))
+}
+
+// DigItemWith works just like DigItem, but takes options determining how keys
+// are matched.
+func (y Document) DigItemWith(path string, opts MatchOptions) (ok bool, val *Element, err error) {
+	if path == "" {
+		return false, nil, fmt.Errorf("%w provided to DigItemWith", ErrEmptyPath)
+	}
+	return dig(path, rootElement(y.Value), opts)
 }
 
-// Remove removes the item under a given path. Returns the modified structure
-// or an error, in case the path cannot be parsed.
+// DigAllWith works just like DigAll, but takes options determining how keys
+// are matched.
+func (y Document) DigAllWith(path string, opts MatchOptions) ([]*Element, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w provided to DigAllWith", ErrEmptyPath)
+	}
+	return digAll(path, rootElement(y.Value), opts)
+}
+
+// DigPathWith works just like DigItemWith, but takes a compiled Path.
+func (y Document) DigPathWith(path Path, opts MatchOptions) (ok bool, val *Element, err error) {
+	return digPath(path, rootElement(y.Value), opts)
+}
+
+// DigAllPathWith works just like DigAllWith, but takes a compiled Path.
+func (y Document) DigAllPathWith(path Path, opts MatchOptions) ([]*Element, error) {
+	return digAllPath(path, rootElement(y.Value), opts)
+}
+
+// Remove removes the item under a given path. In case the path matches several
+// items, only the first one is removed. Returns the removed value or an error,
+// in case the path cannot be parsed.
 func (y Document) Remove(path string) (obj interface{}, err error) {
 	if path == "" {
-		return nil, fmt.Errorf("empty path provided to Remove")
+		return nil, fmt.Errorf("%w provided to Remove", ErrEmptyPath)
 	}
 
-	ok, v, err := y.DigItem(path)
+	p, err := CompilePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return y.RemovePath(p)
+}
+
+// RemovePath works just like Remove, but takes a compiled Path.
+func (y Document) RemovePath(path Path) (obj interface{}, err error) {
+	if path.empty() {
+		return nil, fmt.Errorf("%w provided to RemovePath", ErrEmptyPath)
+	}
+
+	ok, v, err := y.DigPath(path)
 	if err != nil {
 		return nil, err
 	}
 
 	if !ok {
-		return nil, fmt.Errorf("could not find item for path %s", path)
+		return nil, fmt.Errorf("%w for path %s", ErrNotFound, path)
 	}
 
 	if err = v.Remove(); err != nil {
@@ -55,7 +120,7 @@ func (y Document) Remove(path string) (obj interface{}, err error) {
 // can't be parsed or in case an error occurs.
 func (y Document) MustRemove(path string) (obj interface{}) {
 	if path == "" {
-		panic("empty path provided to MustRemove")
+		panic(fmt.Errorf("%w provided to MustRemove", ErrEmptyPath))
 	}
 	obj, err := y.Remove(path)
 	if err != nil {
@@ -64,30 +129,181 @@ func (y Document) MustRemove(path string) (obj interface{}) {
 	return obj
 }
 
+// MustRemovePath works just like MustRemove, but takes a compiled Path.
+func (y Document) MustRemovePath(path Path) (obj interface{}) {
+	obj, err := y.RemovePath(path)
+	if err != nil {
+		panic(err)
+	}
+	return obj
+}
+
+// RemoveAll removes every item under a given path. Returns the removed values,
+// in document order, or an error, in case the path cannot be parsed, no item
+// matches it, or any of the matched items cannot be removed. Nothing is
+// removed in case an error is returned.
+func (y Document) RemoveAll(path string) ([]interface{}, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w provided to RemoveAll", ErrEmptyPath)
+	}
+	p, err := CompilePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return y.RemoveAllPath(p)
+}
+
+// RemoveAllPath works just like RemoveAll, but takes a compiled Path.
+func (y Document) RemoveAllPath(path Path) ([]interface{}, error) {
+	matches, err := y.DigAllPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w for path %s", ErrNotFound, path)
+	}
+
+	// Aliases may lead to the same item more than once, so it is only
+	// removed once.
+	matches = documentOrder(matches)
+
+	// Every item is checked before any of them is removed, so failures leave
+	// the document untouched.
+	for _, m := range matches {
+		if _, err := m.removalIndex(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Values are obtained before any item is removed, as matches may be
+	// nested within each other.
+	removed := make([]interface{}, len(matches))
+	for i, m := range matches {
+		_, removed[i] = m.Interface()
+	}
+	for _, m := range matches {
+		if err := m.Remove(); err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// AliasMode determines how Set handles aliases found along a path.
+type AliasMode int
+
+const (
+	// AliasEditOriginal applies changes below an alias to the anchored
+	// value, so they are visible through every alias referring to it.
+	AliasEditOriginal AliasMode = iota
+
+	// AliasCopy replaces an alias by a copy of the anchored value before
+	// applying changes below it, leaving the original untouched.
+	AliasCopy
+)
+
+// SetOptions holds options used by SetWith and SetPathWith.
+type SetOptions struct {
+	// Aliases determines how aliases found along the path are handled.
+	// Defaults to AliasEditOriginal.
+	Aliases AliasMode
+}
+
 // Set sets a given value to the provided path. Structures are automatically
-// created in case they don't yet exist. Returns a copy of the current structure
-// containing the provided value under the specified path, or an error in case
-// the path cannot be parsed.
+// created in case they don't yet exist. In case the path matches several
+// items, only the first one is replaced. Returns a copy of the current
+// structure containing the provided value under the specified path, or an
+// error in case the path cannot be parsed.
 func (y Document) Set(path string, value interface{}) (obj *Element, err error) {
 	if path == "" {
-		return nil, fmt.Errorf("empty path provided to Set")
+		return nil, fmt.Errorf("%w provided to Set", ErrEmptyPath)
 	}
-	return set(y.Value, path, value)
+	return set(y.Value, path, value, SetOptions{})
+}
+
+// SetPath works just like Set, but takes a compiled Path.
+func (y Document) SetPath(path Path, value interface{}) (obj *Element, err error) {
+	return setPath(y.Value, path, value, SetOptions{})
+}
+
+// SetWith works just like Set, but takes options determining how the value is
+// set.
+func (y Document) SetWith(path string, value interface{}, opts SetOptions) (obj *Element, err error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w provided to SetWith", ErrEmptyPath)
+	}
+	return set(y.Value, path, value, opts)
+}
+
+// SetPathWith works just like SetWith, but takes a compiled Path.
+func (y Document) SetPathWith(path Path, value interface{}, opts SetOptions) (obj *Element, err error) {
+	return setPath(y.Value, path, value, opts)
 }
 
 // MustSet works just like Set, but panics in case the provided path
 // can't be parsed or in case an error occurs.
 func (y Document) MustSet(path string, value interface{}) *Element {
 	if path == "" {
-		panic("empty path provided to MustSet")
+		panic(fmt.Errorf("%w provided to MustSet", ErrEmptyPath))
+	}
+	obj, err := set(y.Value, path, value, SetOptions{})
+	if err != nil {
+		panic(err)
 	}
-	obj, err := set(y.Value, path, value)
+	return obj
+}
+
+// MustSetPath works just like MustSet, but takes a compiled Path.
+func (y Document) MustSetPath(path Path, value interface{}) *Element {
+	obj, err := setPath(y.Value, path, value, SetOptions{})
 	if err != nil {
 		panic(err)
 	}
 	return obj
 }
 
+// DigPointer attempts to retrieve the item referred to by the provided JSON
+// Pointer (RFC 6901), such as /users/0/roles. Returns a boolean indicating if
+// the item was found, the found item, or an error, if parsing the provided
+// pointer fails. The root pointer, an empty string, refers to the document's
+// root value.
+func (y Document) DigPointer(pointer string) (ok bool, val *Element, err error) {
+	p, err := compilePointer(pointer)
+	if err != nil {
+		return false, nil, err
+	}
+	if p.empty() {
+		return true, rootElement(y.Value), nil
+	}
+	return y.DigPath(p)
+}
+
+// SetPointer works just like Set, but takes a JSON Pointer (RFC 6901). The -
+// token refers to the position past the end of a sequence, appending the value
+// to it.
+func (y Document) SetPointer(pointer string, value interface{}) (obj *Element, err error) {
+	p, err := compilePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if p.empty() {
+		return nil, fmt.Errorf("%w provided to SetPointer", ErrEmptyPath)
+	}
+	return y.SetPath(p, value)
+}
+
+// RemovePointer works just like Remove, but takes a JSON Pointer (RFC 6901).
+func (y Document) RemovePointer(pointer string) (obj interface{}, err error) {
+	p, err := compilePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if p.empty() {
+		return nil, fmt.Errorf("%w provided to RemovePointer", ErrEmptyPath)
+	}
+	return y.RemovePath(p)
+}
+
 // Encode encodes the underlying value into a YAML representation
 func (y Document) Encode() ([]byte, error) {
 	return yaml.Marshal(y.Value)
@@ -3,7 +3,7 @@ package uyaml
 func (e *Element) MustString() string {
 	ok, v := e.String()
 	if !ok {
-		panic("MustString: could not convert value to string")
+		panic(e.typeMismatch(KindString))
 	}
 	return v
 }
@@ -11,7 +11,7 @@ func (e *Element) MustString() string {
 func (e *Element) MustFloat() float64 {
 	ok, v := e.Float()
 	if !ok {
-		panic("MustFloat: could not convert value to float64")
+		panic(e.typeMismatch(KindFloat))
 	}
 	return v
 }
@@ -19,7 +19,7 @@ func (e *Element) MustFloat() float64 {
 func (e *Element) MustInt() int64 {
 	ok, v := e.Int()
 	if !ok {
-		panic("MustInt: could not convert value to int64")
+		panic(e.typeMismatch(KindInt))
 	}
 	return v
 }
@@ -27,7 +27,7 @@ func (e *Element) MustInt() int64 {
 func (e *Element) MustBool() bool {
 	ok, v := e.Bool()
 	if !ok {
-		panic("MustBool: could not convert value to bool")
+		panic(e.typeMismatch(KindBool))
 	}
 	return v
 }
@@ -35,7 +35,7 @@ func (e *Element) MustBool() bool {
 func (e *Element) MustMap() map[string]interface{} {
 	ok, v := e.Map()
 	if !ok {
-		panic("MustMap: could not convert value to map[string]interface{}")
+		panic(e.typeMismatch(KindMap))
 	}
 	return v
 }
@@ -43,7 +43,7 @@ func (e *Element) MustMap() map[string]interface{} {
 func (e *Element) MustSlice() []interface{} {
 	ok, v := e.InterfaceSlice()
 	if !ok {
-		panic("MustSlice: could not convert value to []interface{}")
+		panic(e.typeMismatch(KindSlice))
 	}
 	return v
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"gopkg.in/yaml.v3"
 	"strconv"
+	"strings"
 )
 
 var yamlBoolTrue = []string{"y", "Y", "yes", "Yes", "YES", "true", "True", "TRUE", "on", "On", "ON"}
@@ -73,6 +74,30 @@ var tagToKind = map[string]Kind{
 	"!!null":  KindNull,
 }
 
+var kindToTag = map[Kind]string{
+	KindString: "!!str",
+	KindSlice:  "!!seq",
+	KindMap:    "!!map",
+	KindBool:   "!!bool",
+	KindInt:    "!!int",
+	KindFloat:  "!!float",
+	KindNull:   "!!null",
+}
+
+// resolveAlias returns the node referred to by the provided node, in case it is
+// an alias, or the node itself otherwise.
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	if n.Kind != yaml.AliasNode {
+		return n
+	}
+	seen := map[*yaml.Node]bool{}
+	for n.Kind == yaml.AliasNode && n.Alias != nil && !seen[n] {
+		seen[n] = true
+		n = n.Alias
+	}
+	return n
+}
+
 func element(n *yaml.Node) *Element {
 	return &Element{
 		value:  n,
@@ -85,50 +110,151 @@ type Element struct {
 	parent *Element
 }
 
+// node returns the receiver's node, following aliases
+func (e *Element) node() *yaml.Node {
+	return resolveAlias(e.value)
+}
+
 // Remove removes the receiver from its parent. Returns an error in case the
 // item cannot be removed
 func (e *Element) Remove() error {
+	idx, err := e.removalIndex()
+	if err != nil {
+		return err
+	}
+	pn := e.parent.node()
+	start := idx
+	if pn.Kind == yaml.MappingNode {
+		// Also remove the key associated with the receiver
+		start--
+	}
+	pn.Content = append(pn.Content[0:start], pn.Content[idx+1:]...)
+	return nil
+}
+
+// removalIndex returns the index of the receiver within its parent's content,
+// or an error in case the receiver cannot be removed from it.
+func (e *Element) removalIndex() (int, error) {
 	p := e.parent
-	if p.Kind().Is(KindMap) || p.Kind().Is(KindSlice) {
+	if p == nil {
+		return -1, fmt.Errorf("%w: cannot remove element without a parent", ErrUnsupportedParent)
+	}
+
+	switch p.node().Kind {
+	case yaml.SequenceNode, yaml.MappingNode:
 		idx, err := e.indexInParent()
-		if err != nil {
-			return err
+		if err != nil && e.merged() {
+			return -1, fmt.Errorf("%w: cannot remove value provided by a merge key", ErrUnsupportedParent)
 		}
-		e.parent.value.Content = append(e.parent.value.Content[0:idx], e.parent.value.Content[idx+1:]...)
-		return nil
+		return idx, err
 	}
 
-	return fmt.Errorf("cannot remove element from parent of kind %s", p.Kind())
+	return -1, fmt.Errorf("%w: cannot remove element from parent of kind %s", ErrUnsupportedParent, p.Kind())
 }
 
 func (e *Element) indexInParent() (int, error) {
-	p := e.parent
+	p := e.parent.node()
 	itemIdx := -1
-	for i, v := range p.value.Content {
+	for i, v := range p.Content {
+		if p.Kind == yaml.MappingNode && i%2 == 0 {
+			// Skip keys
+			continue
+		}
 		if v == e.value {
 			itemIdx = i
 			break
 		}
 	}
 	if itemIdx == -1 {
-		return -1, fmt.Errorf("couldn't find element %p in parent", e.value)
+		return -1, fmt.Errorf("%w: couldn't find element %p in parent", ErrNotFound, e.value)
 	}
 	return itemIdx, nil
 }
 
+// Key returns the key under which the receiver is stored in its parent.
+// Returns false in case the receiver's parent is not a mapping.
+func (e *Element) Key() (bool, string) {
+	if e.parent == nil || e.parent.node().Kind != yaml.MappingNode {
+		return false, ""
+	}
+	pairs := mappingPairs(e.parent.node())
+	for i := 1; i < len(pairs); i += 2 {
+		if pairs[i] == e.value {
+			return true, resolveAlias(pairs[i-1]).Value
+		}
+	}
+	return false, ""
+}
+
+// merged returns whether the receiver is a value provided to its parent by a
+// merge key, rather than one of its own entries.
+func (e *Element) merged() bool {
+	if e.parent == nil || !hasMergeKeys(e.parent.node()) {
+		return false
+	}
+	_, err := e.indexInParent()
+	ok, _ := e.Key()
+	return err != nil && ok
+}
+
+// pathString returns a path leading from the document's root to the receiver,
+// built from its chain of parents.
+func (e *Element) pathString() string {
+	var segments []string
+	for el := e; el.parent != nil; el = el.parent {
+		switch el.parent.node().Kind {
+		case yaml.MappingNode:
+			_, key := el.Key()
+			segments = append(segments, string(dot)+EscapeKey(key))
+		case yaml.SequenceNode:
+			idx, err := el.indexInParent()
+			if err != nil {
+				return ""
+			}
+			segments = append(segments, "["+strconv.Itoa(idx)+"]")
+		}
+	}
+	var b strings.Builder
+	for i := len(segments) - 1; i >= 0; i-- {
+		b.WriteString(segments[i])
+	}
+	return strings.TrimPrefix(b.String(), string(dot))
+}
+
+// typeMismatch returns a TypeMismatchError indicating that the receiver was
+// expected to be of the provided Kind.
+func (e *Element) typeMismatch(expected Kind) error {
+	return &TypeMismatchError{Path: e.pathString(), Expected: expected, Actual: e.Kind()}
+}
+
 // Replace replaces the receiver in its parent, returning the new Element
 // placed on its previous value.
 func (e *Element) Replace(newValue interface{}) (*Element, error) {
-	idx, err := e.indexInParent()
+	if e.parent == nil {
+		return nil, fmt.Errorf("%w: cannot replace element without a parent", ErrUnsupportedParent)
+	}
+	n, err := buildNode(newValue)
 	if err != nil {
 		return nil, err
 	}
-	n, err := buildNode(newValue)
+	idx, err := e.indexInParent()
+	if err != nil && e.merged() {
+		// Values provided by merge keys are overridden by a new key in the
+		// parent, leaving the merged mapping untouched.
+		_, key := e.Key()
+		pn := e.parent.node()
+		pn.Content = append(pn.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, n)
+		nel := element(n)
+		nel.parent = e.parent
+		return nel, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	e.parent.value.Content[idx] = n
-	return element(n), nil
+	e.parent.node().Content[idx] = n
+	nel := element(n)
+	nel.parent = e.parent
+	return nel, nil
 }
 
 // Decode decodes the receiver into a provided struct pointer
@@ -138,7 +264,8 @@ func (e *Element) Decode(into interface{}) error {
 
 // Kind returns the receiver's element Kind
 func (e *Element) Kind() Kind {
-	k, ok := tagToKind[e.value.Tag]
+	n := e.node()
+	k, ok := tagToKind[n.Tag]
 	if !ok {
 		return KindInvalid
 	}
@@ -146,12 +273,13 @@ func (e *Element) Kind() Kind {
 	// Seq?
 	if k == KindSlice {
 		nodeKind := ""
-		for _, v := range e.value.Content {
+		for _, v := range n.Content {
+			tag := resolveAlias(v).Tag
 			if nodeKind == "" {
-				nodeKind = v.Tag
+				nodeKind = tag
 				continue
 			}
-			if v.Tag != nodeKind {
+			if tag != nodeKind {
 				return KindSliceMixed
 			}
 		}
@@ -168,13 +296,35 @@ func (e *Element) Kind() Kind {
 // a boolean indicating if an item was found, the found item, or an error,
 // if parsing the provided path fails.
 func (e *Element) Dig(path string) (bool, *Element, error) {
-	return dig(path, e.value)
+	return dig(path, e, MatchOptions{})
+}
+
+// DigAll retrieves all items matching the provided path, relative to the
+// receiver, in document order. Returns an empty slice in case no item matches
+// the path, or an error, if parsing the provided path fails.
+func (e *Element) DigAll(path string) ([]*Element, error) {
+	return digAll(path, e, MatchOptions{})
 }
 
 // MustDig works just like Dig, but panics in case the provided path
 // can't be parsed or in case an item cannot be retrieved.
 func (e *Element) MustDig(path string) *Element {
-	return mustDig(path, e.value)
+	return mustDig(path, e)
+}
+
+// DigPath works just like Dig, but takes a compiled Path.
+func (e *Element) DigPath(path Path) (bool, *Element, error) {
+	return digPath(path, e, MatchOptions{})
+}
+
+// DigAllPath works just like DigAll, but takes a compiled Path.
+func (e *Element) DigAllPath(path Path) ([]*Element, error) {
+	return digAllPath(path, e, MatchOptions{})
+}
+
+// MustDigPath works just like MustDig, but takes a compiled Path.
+func (e *Element) MustDigPath(path Path) *Element {
+	return mustDigPath(path, e)
 }
 
 // String returns a boolean indicating whether the receiver can be coerced into
@@ -183,7 +333,7 @@ func (e *Element) String() (bool, string) {
 	if e.Kind() != KindString {
 		return false, ""
 	}
-	return true, e.value.Value
+	return true, e.node().Value
 }
 
 func (e *Element) anyOf(kinds ...Kind) bool {
@@ -204,7 +354,7 @@ func (e *Element) Float() (bool, float64) {
 		ok, v := e.Int()
 		return ok, float64(v)
 	case KindFloat:
-		v, _ := strconv.ParseFloat(e.value.Value, 64)
+		v, _ := strconv.ParseFloat(e.node().Value, 64)
 		return true, v
 	}
 	return false, 0
@@ -215,7 +365,7 @@ func (e *Element) Float() (bool, float64) {
 func (e *Element) Int() (bool, int64) {
 	switch e.Kind() {
 	case KindInt:
-		v, _ := strconv.ParseInt(e.value.Value, 10, 64)
+		v, _ := strconv.ParseInt(e.node().Value, 10, 64)
 		return true, v
 	case KindFloat:
 		ok, v := e.Float()
@@ -231,9 +381,10 @@ func (e *Element) Bool() (bool, bool) {
 		return false, false
 	}
 
+	value := e.node().Value
 	ok := false
 	for _, v := range yamlBool {
-		if v == e.value.Value {
+		if v == value {
 			ok = true
 		}
 	}
@@ -243,7 +394,7 @@ func (e *Element) Bool() (bool, bool) {
 	}
 
 	for _, v := range yamlBoolTrue {
-		if v == e.value.Value {
+		if v == value {
 			return true, true
 		}
 	}
@@ -254,18 +405,29 @@ func (e *Element) Bool() (bool, bool) {
 // Map returns a boolean indicating whether the receiver can be coerced into
 // a map[string]interface{}, and if positive, the receiver's value
 func (e *Element) Map() (bool, map[string]interface{}) {
+	return e.mapValue(map[*yaml.Node]bool{})
+}
+
+// mapValue works just like Map, using expanding to hold the anchored nodes
+// being expanded, so values containing themselves through aliases are
+// rejected rather than expanded indefinitely.
+func (e *Element) mapValue(expanding map[*yaml.Node]bool) (bool, map[string]interface{}) {
 	if e.Kind() != KindMap {
 		return false, nil
 	}
+	if !e.expand(expanding) {
+		return false, nil
+	}
+	defer delete(expanding, e.node())
 
 	m := map[string]interface{}{}
 	var k string
 	var ok bool
-	for i, v := range e.value.Content {
+	for i, v := range mappingPairs(e.node()) {
 		if i%2 == 0 {
-			k = v.Value
+			k = resolveAlias(v).Value
 		} else {
-			ok, m[k] = element(v).Interface()
+			ok, m[k] = element(v).interfaceValue(expanding)
 			if !ok {
 				return false, nil
 			}
@@ -275,9 +437,27 @@ func (e *Element) Map() (bool, map[string]interface{}) {
 	return true, m
 }
 
+// expand marks the receiver's node as being expanded in the provided set.
+// Returns false in case it is already being expanded, which happens when a
+// value contains itself through an alias.
+func (e *Element) expand(expanding map[*yaml.Node]bool) bool {
+	n := e.node()
+	if expanding[n] {
+		return false
+	}
+	expanding[n] = true
+	return true
+}
+
 // Interface returns a boolean indicating whether the receiver can be coerced
 // into a generic interface{} value, and if positive, the receiver's value
 func (e *Element) Interface() (bool, interface{}) {
+	return e.interfaceValue(map[*yaml.Node]bool{})
+}
+
+// interfaceValue works just like Interface, using expanding to hold the
+// nodes being expanded, just like mapValue.
+func (e *Element) interfaceValue(expanding map[*yaml.Node]bool) (bool, interface{}) {
 	switch e.Kind() {
 	case KindString:
 		return e.String()
@@ -288,7 +468,7 @@ func (e *Element) Interface() (bool, interface{}) {
 	case KindBool:
 		return e.Bool()
 	case KindMap:
-		return e.Map()
+		return e.mapValue(expanding)
 	case KindInterface:
 	// ?
 	case KindNull:
@@ -296,7 +476,7 @@ func (e *Element) Interface() (bool, interface{}) {
 	}
 
 	if e.Kind()&KindSlice == KindSlice {
-		return e.InterfaceSlice()
+		return e.sliceValue(expanding)
 	}
 	return false, nil
 }
@@ -308,9 +488,9 @@ func (e *Element) StringSlice() (bool, []string) {
 		return false, nil
 	}
 
-	arr := make([]string, 0, len(e.value.Content))
-	for _, v := range e.value.Content {
-		arr = append(arr, v.Value)
+	arr := make([]string, 0, len(e.node().Content))
+	for _, v := range e.node().Content {
+		arr = append(arr, resolveAlias(v).Value)
 	}
 
 	return true, arr
@@ -323,8 +503,8 @@ func (e *Element) FloatSlice() (bool, []float64) {
 		return false, nil
 	}
 
-	arr := make([]float64, 0, len(e.value.Content))
-	for _, v := range e.value.Content {
+	arr := make([]float64, 0, len(e.node().Content))
+	for _, v := range e.node().Content {
 		arr = append(arr, element(v).MustFloat())
 	}
 
@@ -338,8 +518,8 @@ func (e *Element) IntSlice() (bool, []int64) {
 		return false, nil
 	}
 
-	arr := make([]int64, 0, len(e.value.Content))
-	for _, v := range e.value.Content {
+	arr := make([]int64, 0, len(e.node().Content))
+	for _, v := range e.node().Content {
 		arr = append(arr, element(v).MustInt())
 	}
 
@@ -353,8 +533,8 @@ func (e *Element) BoolSlice() (bool, []bool) {
 		return false, nil
 	}
 
-	arr := make([]bool, 0, len(e.value.Content))
-	for _, v := range e.value.Content {
+	arr := make([]bool, 0, len(e.node().Content))
+	for _, v := range e.node().Content {
 		arr = append(arr, element(v).MustBool())
 	}
 
@@ -368,8 +548,8 @@ func (e *Element) MapSlice() (bool, []map[string]interface{}) {
 		return false, nil
 	}
 
-	arr := make([]map[string]interface{}, 0, len(e.value.Content))
-	for _, v := range e.value.Content {
+	arr := make([]map[string]interface{}, 0, len(e.node().Content))
+	for _, v := range e.node().Content {
 		ok, f := element(v).Map()
 		if !ok {
 			return false, nil
@@ -383,13 +563,23 @@ func (e *Element) MapSlice() (bool, []map[string]interface{}) {
 // InterfaceSlice returns a boolean indicating whether the receiver can be
 // coerced into a []interface{} value, and if positive, the receiver's value
 func (e *Element) InterfaceSlice() (bool, []interface{}) {
+	return e.sliceValue(map[*yaml.Node]bool{})
+}
+
+// sliceValue works just like InterfaceSlice, using expanding to hold the
+// nodes being expanded, just like mapValue.
+func (e *Element) sliceValue(expanding map[*yaml.Node]bool) (bool, []interface{}) {
 	if e.Kind()&KindSlice != KindSlice {
 		return false, nil
 	}
+	if !e.expand(expanding) {
+		return false, nil
+	}
+	defer delete(expanding, e.node())
 
-	arr := make([]interface{}, 0, len(e.value.Content))
-	for _, v := range e.value.Content {
-		ok, val := element(v).Interface()
+	arr := make([]interface{}, 0, len(e.node().Content))
+	for _, v := range e.node().Content {
+		ok, val := element(v).interfaceValue(expanding)
 		if !ok {
 			return false, nil
 		}
@@ -1,6 +1,27 @@
 package uyaml
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotFound indicates that no item matches a given path
+	ErrNotFound = errors.New("item not found")
+
+	// ErrEmptyPath indicates that an empty path was provided
+	ErrEmptyPath = errors.New("empty path")
+
+	// ErrUnsupportedParent indicates that an element cannot be removed or
+	// replaced, either because it has no parent, or because its parent is not
+	// a mapping or sequence.
+	ErrUnsupportedParent = errors.New("unsupported parent")
+
+	// ErrOutOfRange indicates that a position cannot be set, either because
+	// it is negative, or because it lies too far past the end of a sequence.
+	ErrOutOfRange = errors.New("position out of range")
+)
 
 type ErrBug struct {
 	msg string
@@ -13,3 +34,44 @@ func (e ErrBug) Error() string {
 func bug(format string, a ...interface{}) error {
 	return ErrBug{msg: "BUG: " + fmt.Sprintf(format, a...)}
 }
+
+// PathSyntaxError represents an error found while parsing a path
+type PathSyntaxError struct {
+	// Path holds the path being parsed
+	Path string
+
+	// Offset holds the byte offset of the offending character within Path
+	Offset int
+
+	// Message describes the error
+	Message string
+
+	// Expected lists the tokens accepted at Offset, such as "']'" or
+	// "digit", when known.
+	Expected []string
+}
+
+func (e *PathSyntaxError) Error() string {
+	return fmt.Sprintf("could not parse:\n%s\n%s^ %s", e.Path, strings.Repeat(" ", e.Offset), e.Message)
+}
+
+// TypeMismatchError indicates that the value under a path does not have the
+// Kind required by an operation.
+type TypeMismatchError struct {
+	// Path holds the path of the offending value, or an empty string for the
+	// document's root.
+	Path string
+
+	// Expected holds the Kind required by the operation
+	Expected Kind
+
+	// Actual holds the Kind of the value found under Path
+	Actual Kind
+}
+
+func (e *TypeMismatchError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("expected %s, found %s", e.Expected, e.Actual)
+	}
+	return fmt.Sprintf("expected %s at %s, found %s", e.Expected, e.Path, e.Actual)
+}
@@ -0,0 +1,67 @@
+package uyaml
+
+import (
+	"strings"
+	"unicode"
+)
+
+// KeyNormalization determines how keys are normalized before being compared
+// against path components.
+type KeyNormalization int
+
+const (
+	// NormalizeNone compares keys as they are.
+	NormalizeNone KeyNormalization = iota
+
+	// SnakeAndCamel compares keys regardless of whether their words are
+	// written in snake_case or camelCase, so maxRetries matches max_retries.
+	// As words are delimited by their case, keys are also compared
+	// regardless of it.
+	SnakeAndCamel
+)
+
+// MatchOptions holds options determining how keys found in a document are
+// matched against the keys used by a path, used by DigItemWith and
+// DigAllWith. The zero value matches keys exactly.
+type MatchOptions struct {
+	// CaseInsensitive matches keys regardless of their case.
+	CaseInsensitive bool
+
+	// Normalize determines how keys are normalized before being compared.
+	Normalize KeyNormalization
+}
+
+// keyMatches returns whether the provided document key matches the key used
+// by a path.
+func (o MatchOptions) keyMatches(key, want string) bool {
+	if key == want {
+		return true
+	}
+	if o.Normalize == SnakeAndCamel {
+		key, want = snakeCase(key), snakeCase(want)
+	}
+	if o.CaseInsensitive {
+		return strings.EqualFold(key, want)
+	}
+	return key == want
+}
+
+// snakeCase returns the provided camelCase or snake_case key in snake_case.
+// A word starts at each uppercase letter following a lowercase letter or a
+// digit, and at the last uppercase letter of a run followed by a lowercase
+// one, so HTTPServer becomes http_server.
+func snakeCase(key string) string {
+	runes := []rune(key)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 && runes[i-1] != '_' {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package uyaml
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// isMergeKey returns whether the provided mapping key is a merge key (<<).
+func isMergeKey(k *yaml.Node) bool {
+	k = resolveAlias(k)
+	return k.Kind == yaml.ScalarNode && k.ShortTag() == "!!merge"
+}
+
+// mergeSources returns the mappings merged by the provided merge key value,
+// which may either be a mapping or a sequence of mappings. Returns false in
+// case the value cannot be merged.
+func mergeSources(v *yaml.Node) ([]*yaml.Node, bool) {
+	v = resolveAlias(v)
+	switch v.Kind {
+	case yaml.MappingNode:
+		return []*yaml.Node{v}, true
+	case yaml.SequenceNode:
+		sources := make([]*yaml.Node, 0, len(v.Content))
+		for _, s := range v.Content {
+			s = resolveAlias(s)
+			if s.Kind != yaml.MappingNode {
+				return nil, false
+			}
+			sources = append(sources, s)
+		}
+		return sources, true
+	}
+	return nil, false
+}
+
+// mappingPairs returns the keys and values of the provided mapping node,
+// interleaved as in its Content, with merge keys replaced by the entries they
+// merge. Keys defined in the mapping itself override merged ones, and earlier
+// merge sources override later ones. Merge keys holding values that cannot be
+// merged are kept as regular entries.
+func mappingPairs(obj *yaml.Node) []*yaml.Node {
+	return collectPairs(obj, map[*yaml.Node]bool{})
+}
+
+func collectPairs(obj *yaml.Node, expanding map[*yaml.Node]bool) []*yaml.Node {
+	if !hasMergeKeys(obj) {
+		return obj.Content
+	}
+	if expanding[obj] {
+		// Mappings merging themselves contribute no further entries
+		return nil
+	}
+	expanding[obj] = true
+	defer delete(expanding, obj)
+
+	local := map[string]bool{}
+	for i := 0; i+1 < len(obj.Content); i += 2 {
+		if !isMergeKey(obj.Content[i]) {
+			local[resolveAlias(obj.Content[i]).Value] = true
+		}
+	}
+
+	seen := map[string]bool{}
+	pairs := make([]*yaml.Node, 0, len(obj.Content))
+	for i := 0; i+1 < len(obj.Content); i += 2 {
+		k, v := obj.Content[i], obj.Content[i+1]
+		sources, ok := mergeSources(v)
+		if !isMergeKey(k) || !ok {
+			seen[resolveAlias(k).Value] = true
+			pairs = append(pairs, k, v)
+			continue
+		}
+		for _, s := range sources {
+			merged := collectPairs(s, expanding)
+			for j := 0; j+1 < len(merged); j += 2 {
+				key := resolveAlias(merged[j]).Value
+				if local[key] || seen[key] {
+					continue
+				}
+				seen[key] = true
+				pairs = append(pairs, merged[j], merged[j+1])
+			}
+		}
+	}
+	return pairs
+}
+
+// hasMergeKeys returns whether the provided node is a mapping containing
+// merge keys.
+func hasMergeKeys(obj *yaml.Node) bool {
+	if obj.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i < len(obj.Content); i += 2 {
+		if isMergeKey(obj.Content[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveMerges replaces merge keys (<<) found in the receiver and its
+// descendants by copies of the entries they merge, so the structure no longer
+// depends on them. Keys defined in a mapping itself keep their values.
+func (e *Element) ResolveMerges() {
+	resolveMerges(e.value)
+}
+
+func resolveMerges(n *yaml.Node) {
+	if hasMergeKeys(n) {
+		pairs := mappingPairs(n)
+		local := map[*yaml.Node]bool{}
+		for _, c := range n.Content {
+			local[c] = true
+		}
+		content := make([]*yaml.Node, len(pairs))
+		for i, p := range pairs {
+			if local[p] {
+				content[i] = p
+			} else {
+				content[i] = detachedCopy(p)
+			}
+		}
+		n.Content = content
+	}
+	for _, c := range n.Content {
+		resolveMerges(c)
+	}
+}
@@ -2,7 +2,12 @@ package uyaml
 
 import (
 	"fmt"
+	"gopkg.in/yaml.v3"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type parseState int
@@ -10,104 +15,387 @@ type parseState int
 const (
 	parseStateKey parseState = iota
 
-	// Selectors
-	parseStateSelectorKey       // After leftParen found right after a dot
-	parseStateSelectorOpenQuote // Quote, after parseStateSelectorKey
-	parseStateSelectorValue     // Anything until unescaped quote
-	parseStateSelectorEnd       // rightParen, after parseStateSelectorValue
+	// Indexes
+	parseStateIndex // Index, slice or wildcard until rightBracket, after leftBracket
 
-	// Required after a parseStateSelectorEnd, just to ensure we have a dot.
+	// Required after a selector or parseStateIndex, just to ensure we have a
+	// dot or another index.
 	parseStateMatchDot
 )
 
 const (
-	dot        = '.'
-	leftParen  = '('
-	rightParen = ')'
-	equal      = '='
-	quote      = '\''
-	escape     = '\\'
+	dot          = '.'
+	leftParen    = '('
+	rightParen   = ')'
+	leftBracket  = '['
+	rightBracket = ']'
+	equal        = '='
+	bang         = '!'
+	less         = '<'
+	greater      = '>'
+	tilde        = '~'
+	caret        = '^'
+	dollar       = '$'
+	quote        = '\''
+	doubleQuote  = '"'
+	ampersand    = '&'
+	pipe         = '|'
+	escape       = '\\'
+	colon        = ':'
+	minus        = '-'
+	asterisk     = '*'
+	leftBrace    = '{'
+	rightBrace   = '}'
+	comma        = ','
 )
 
 type pathKey string
+type pathIndex int
+type pathSlice struct {
+	Start    int
+	End      int
+	HasStart bool
+	HasEnd   bool
+}
+type pathWildcard struct{}
+type pathRecursive struct{}
+type pathParent struct{}
+
+// pathUnion matches the items matched by any of its branches, each of them
+// being a list of path components evaluated relative to the current item.
+type pathUnion struct {
+	Branches [][]interface{}
+}
+
+// pathFunction is a terminal component returning a value computed from each
+// matched item, rather than the item itself.
+type pathFunction string
+
+const (
+	funcLength pathFunction = "length"
+	funcKeys   pathFunction = "keys"
+	funcType   pathFunction = "type"
+)
+
+var pathFunctions = map[string]pathFunction{
+	string(funcLength): funcLength,
+	string(funcKeys):   funcKeys,
+	string(funcType):   funcType,
+}
+
+type pseudoKind int
+
+const (
+	pseudoFirst pseudoKind = iota
+	pseudoLast
+	pseudoNth
+	pseudoEven
+	pseudoOdd
+)
+
+// pseudoNames maps the names of positional pseudo-selectors to their kind
+var pseudoNames = map[string]pseudoKind{
+	"first": pseudoFirst,
+	"last":  pseudoLast,
+	"nth":   pseudoNth,
+	"even":  pseudoEven,
+	"odd":   pseudoOdd,
+}
+
+// pathPositional narrows the items matched by Base according to their
+// position. N holds the 1-based position used by pseudoNth.
+type pathPositional struct {
+	Base   interface{}
+	Pseudo pseudoKind
+	N      int
+}
+
+// bounds returns the start and end positions of the receiver for a sequence
+// of the provided length, resolving negative and omitted positions.
+func (s pathSlice) bounds(length int) (start, end int) {
+	start, end = 0, length
+	if s.HasStart {
+		start = s.Start
+	}
+	if s.HasEnd {
+		end = s.End
+	}
+	clamp := func(i int) int {
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			return 0
+		}
+		if i > length {
+			return length
+		}
+		return i
+	}
+	return clamp(start), clamp(end)
+}
+
+type selectorOperator int
+
+const (
+	opEqual selectorOperator = iota
+	opNotEqual
+	opLess
+	opLessEqual
+	opGreater
+	opGreaterEqual
+	opMatch    // Regular expression
+	opPrefix   // Starts with
+	opSuffix   // Ends with
+	opContains // Contains
+)
+
+// selectorOperatorRunes maps runes starting a selector operator to the
+// operator they represent.
+var selectorOperatorRunes = map[rune]selectorOperator{
+	equal:    opEqual,
+	bang:     opNotEqual,
+	less:     opLess,
+	greater:  opGreater,
+	tilde:    opMatch,
+	caret:    opPrefix,
+	dollar:   opSuffix,
+	asterisk: opContains,
+}
+
+// isStringOperator returns whether the receiver only applies to string
+// values.
+func (o selectorOperator) isStringOperator() bool {
+	return o >= opMatch
+}
+
 type pathSelector struct {
-	Key   string
-	Value string
+	Expr selectorExpr
+}
+
+// selectorExpr represents a boolean expression evaluated by a selector against
+// each of its candidate items.
+type selectorExpr interface {
+	matches(item *yaml.Node, opts MatchOptions) bool
+	String() string
+}
+
+type selectorComparison struct {
+	// Key holds the path compared by the selector, as written, while Path
+	// holds its components. An empty Path refers to the item itself.
+	Key      string
+	Path     []interface{}
+	Operator selectorOperator
+	Value    string
+
+	// Kind indicates the type of Value. Quoted values are represented by
+	// KindString, while unquoted literals use KindInt, KindFloat, KindBool or
+	// KindNull.
+	Kind Kind
+
+	// Pattern holds the compiled regular expression for opMatch selectors
+	Pattern *regexp.Regexp
+}
+type selectorExists struct {
+	Key  string
+	Path []interface{}
+}
+type selectorAnd []selectorExpr
+type selectorOr []selectorExpr
+type selectorNot struct {
+	Expr selectorExpr
 }
 
 func parsePath(path string) ([]interface{}, error) {
 	if len(path) == 0 {
-		return nil, fmt.Errorf("empty string provided to parsePath")
+		return nil, fmt.Errorf("%w provided to parsePath", ErrEmptyPath)
 	}
+	return parseComponents(path, 0, len(path))
+}
 
+// parseComponents parses the components of the path contained in
+// path[start:end]. Errors report positions relative to the whole path.
+func parseComponents(path string, start, end int) ([]interface{}, error) {
 	var state parseState
 	var tmpString []rune
 	var constructed []interface{}
 	var escaping bool
-	var tmpKV pathSelector
+	var escapedKey bool
+	var skip int
 	apnd := func(r rune) {
+		if r == escape && !escaping {
+			escaping = true
+			escapedKey = true
+			return
+		}
 		tmpString = append(tmpString, r)
-		escaping = r == escape
+		escaping = false
+	}
+	flushKey := func() {
+		if escapedKey {
+			// Escaped keys are always taken literally
+			constructed = append(constructed, pathKey(tmpString))
+		} else {
+			constructed = appendComponent(constructed, keyComponent(tmpString))
+		}
+		tmpString = tmpString[:0]
+		escapedKey = false
 	}
 
-	for pos, c := range path {
+	for i, c := range path[start:end] {
+		pos := start + i
+		if pos < skip {
+			// Consumed by a selector
+			continue
+		}
 		switch state {
 		case parseStateKey:
 			if c == dot && !escaping {
-				constructed = append(constructed, pathKey(tmpString))
-				tmpString = tmpString[:0]
+				if len(tmpString) == 0 && !escapedKey && pos > start && path[pos-1] == dot {
+					// Two consecutive dots denote a recursive descent
+					constructed = appendComponent(constructed, pathRecursive{})
+					break
+				}
+				flushKey()
+				break
+			} else if c == leftBracket && !escaping {
+				// Brackets must either follow a key, or start the path
+				if len(tmpString) == 0 && !escapedKey && pos > start {
+					return nil, makeError("unexpected '['", path, pos)
+				}
+				if len(tmpString) > 0 || escapedKey {
+					flushKey()
+				}
+				state = parseStateIndex
+				break
+			} else if (c == quote || c == doubleQuote) && !escaping && len(tmpString) == 0 && !escapedKey {
+				// Quoted keys are taken literally, and span the whole
+				// segment
+				key, next, err := scanQuoted(path, pos, end)
+				if err != nil {
+					return nil, err
+				}
+				constructed = append(constructed, pathKey(key))
+				skip = next
+				state = parseStateMatchDot
+				break
+			} else if c == colon && !escaping && (len(tmpString) > 0 || escapedKey) {
+				pseudo, next, ok, err := parsePseudo(path, pos, end)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					// Colons not starting a pseudo-selector are part of
+					// the key
+					apnd(c)
+					break
+				}
+				flushKey()
+				constructed = attachPseudo(constructed, pseudo)
+				skip = next
+				state = parseStateMatchDot
+				break
+			} else if c == leftBrace && !escaping && len(tmpString) == 0 && !escapedKey {
+				union, next, err := parseUnion(path, pos, end)
+				if err != nil {
+					return nil, err
+				}
+				constructed = append(constructed, union)
+				skip = next
+				state = parseStateMatchDot
 				break
 			} else if c == leftParen && !escaping {
+				if fn, ok := pathFunctions[string(tmpString)]; ok && !escapedKey && strings.HasPrefix(path[pos:end], "()") {
+					if pos+2 < end {
+						return nil, makeError("functions must be the last segment of a path", path, pos+2)
+					}
+					constructed = append(constructed, fn)
+					tmpString = tmpString[:0]
+					skip = end
+					state = parseStateMatchDot
+					break
+				}
 				// We should have a dot before opening parens
-				if len(tmpString) > 0 {
+				if len(tmpString) > 0 || escapedKey {
 					return nil, makeError("unexpected '('", path, pos)
 				}
-				state = parseStateSelectorKey
+				sel, next, err := parseSelector(path, pos, end)
+				if err != nil {
+					return nil, err
+				}
+				constructed = append(constructed, sel)
+				skip = next
+				state = parseStateMatchDot
 				break
 			}
 			apnd(c)
-		case parseStateSelectorKey:
-			if c == equal && !escaping {
-				if len(tmpString) == 0 {
-					// Equal before value?
-					return nil, makeError("unexpected '='", path, pos)
+		case parseStateIndex:
+			if (c == quote || c == doubleQuote) && len(tmpString) == 0 {
+				key, next, err := scanQuoted(path, pos, end)
+				if err != nil {
+					return nil, err
+				}
+				if next >= end {
+					return nil, eofError(path, end, "']'")
+				}
+				if path[next] != rightBracket {
+					return nil, expectError(path, next, "']'")
+				}
+				constructed = append(constructed, pathKey(key))
+				skip = next + 1
+				state = parseStateMatchDot
+				break
+			}
+			if c == rightBracket {
+				component, ok := parseBracket(string(tmpString))
+				if !ok {
+					return nil, makeError("invalid index or slice", path, pos)
 				}
-				tmpKV.Key = string(tmpString)
+				constructed = append(constructed, component)
 				tmpString = tmpString[:0]
-				state = parseStateSelectorOpenQuote
+				state = parseStateMatchDot
 				break
-			} else if (c == leftParen || c == rightParen || c == dot) && !escaping {
-				return nil, makeError("unexpected token", path, pos)
 			}
-			apnd(c)
-
-		case parseStateSelectorOpenQuote:
-			// Just check for an opening quote.
-			if c != quote {
-				return nil, makeError("expected quote", path, pos)
+			if (c < '0' || c > '9') && c != minus && c != colon && c != asterisk {
+				return nil, expectError(path, pos, "digit", "'-'", "':'", "'*'", "quote", "']'")
 			}
-			state = parseStateSelectorValue
-
-		case parseStateSelectorValue:
-			if c == quote && !escaping {
-				tmpKV.Value = string(tmpString)
-				tmpString = tmpString[:0]
-				state = parseStateSelectorEnd
+			tmpString = append(tmpString, c)
+		case parseStateMatchDot:
+			if c == leftBracket {
+				state = parseStateIndex
 				break
 			}
-			apnd(c)
-		case parseStateSelectorEnd:
-			if c == rightParen {
-				constructed = append(constructed, tmpKV)
-				tmpKV.Key = ""
-				tmpKV.Value = ""
-				state = parseStateMatchDot
+			if c == colon {
+				pseudo, next, ok, err := parsePseudo(path, pos, end)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					return nil, expectError(path, pos+1, "first", "last", "nth", "even", "odd")
+				}
+				constructed = attachPseudo(constructed, pseudo)
+				skip = next
+				break
+			}
+			if prev, ok := constructed[len(constructed)-1].(pathSelector); ok && c == comma {
+				// Selectors separated by commas match items satisfying
+				// any of them.
+				if pos+1 >= end {
+					return nil, eofError(path, end, "'('")
+				}
+				if path[pos+1] != leftParen {
+					return nil, expectError(path, pos+1, "'('")
+				}
+				sel, next, err := parseSelector(path, pos+1, end)
+				if err != nil {
+					return nil, err
+				}
+				constructed[len(constructed)-1] = pathSelector{Expr: joinSelectorOr(prev.Expr, sel.Expr)}
+				skip = next
 				break
 			}
-			return nil, makeError("expected ')'", path, pos)
-		case parseStateMatchDot:
 			if c != dot {
-				return nil, makeError("expected EOF or '.'", path, pos)
+				return nil, expectError(path, pos, "EOF", "'.'", "'['", "':'")
 			}
 			state = parseStateKey
 		default:
@@ -115,18 +403,595 @@ func parsePath(path string) ([]interface{}, error) {
 		}
 	}
 
-	switch state {
-	case parseStateKey, parseStateMatchDot, parseStateSelectorKey:
-		if len(tmpString) > 0 {
-			constructed = append(constructed, pathKey(tmpString))
+	switch {
+	case escaping:
+		return nil, eofError(path, end)
+	case state == parseStateKey, state == parseStateMatchDot:
+		if len(tmpString) > 0 || escapedKey {
+			flushKey()
 		}
 	default:
-		return nil, makeError("unexpected EOF", path, len(path)-1)
+		return nil, eofError(path, end, "']'")
 	}
 
 	return constructed, nil
 }
 
+// parsePseudo parses a positional pseudo-selector starting at the colon located
+// at pos, and ending before end, returning it along with the position right
+// after it. Returns false in case the input does not continue with a
+// pseudo-selector name followed by EOF, '.', '[' or ':'.
+func parsePseudo(path string, pos, end int) (pathPositional, int, bool, error) {
+	nameStart := pos + 1
+	nameEnd := nameStart
+	for nameEnd < end && path[nameEnd] >= 'a' && path[nameEnd] <= 'z' {
+		nameEnd++
+	}
+	kind, ok := pseudoNames[path[nameStart:nameEnd]]
+	if !ok {
+		return pathPositional{}, 0, false, nil
+	}
+	pseudo := pathPositional{Pseudo: kind}
+	next := nameEnd
+
+	if kind == pseudoNth {
+		if next >= end || path[next] != leftParen {
+			return pathPositional{}, 0, false, nil
+		}
+		closing := strings.IndexRune(path[next:end], rightParen)
+		if closing == -1 {
+			return pathPositional{}, 0, false, eofError(path, end, "')'")
+		}
+		arg := strings.TrimSpace(path[next+1 : next+closing])
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return pathPositional{}, 0, false, makeError("expected a position starting at 1", path, next+1)
+		}
+		pseudo.N = n
+		next += closing + 1
+	}
+
+	if next < end && !strings.ContainsRune(".[:", rune(path[next])) {
+		return pathPositional{}, 0, false, nil
+	}
+	return pseudo, next, true, nil
+}
+
+// attachPseudo attaches the provided pseudo-selector to the last component of
+// list. Pseudo-selectors following keys and indexes narrow the items of the
+// value they match, while the ones following other components narrow the
+// items matched by them.
+func attachPseudo(list []interface{}, pseudo pathPositional) []interface{} {
+	last := list[len(list)-1]
+	switch last.(type) {
+	case pathKey, pathIndex:
+		pseudo.Base = pathWildcard{}
+		return append(list, pseudo)
+	}
+	pseudo.Base = last
+	list[len(list)-1] = pseudo
+	return list
+}
+
+// joinSelectorOr returns an expression satisfied by items satisfying either a
+// or b.
+func joinSelectorOr(a, b selectorExpr) selectorExpr {
+	if or, ok := a.(selectorOr); ok {
+		return append(or, b)
+	}
+	return selectorOr{a, b}
+}
+
+// parseUnion parses a union starting at the opening brace located at pos, and
+// ending before end, returning the union and the position right after its
+// closing brace. Branches are separated by commas, and each of them may hold
+// a path of its own.
+func parseUnion(path string, pos, end int) (pathUnion, int, error) {
+	var union pathUnion
+	branchStart := pos + 1
+	depth := 0
+	addBranch := func(branchEnd int) error {
+		for branchStart < branchEnd && unicode.IsSpace(rune(path[branchStart])) {
+			branchStart++
+		}
+		for branchEnd > branchStart && unicode.IsSpace(rune(path[branchEnd-1])) {
+			branchEnd--
+		}
+		if branchStart == branchEnd {
+			return expectError(path, branchEnd, "key")
+		}
+		components, err := parseComponents(path, branchStart, branchEnd)
+		if err != nil {
+			return err
+		}
+		union.Branches = append(union.Branches, components)
+		return nil
+	}
+
+	for i := pos + 1; i < end; {
+		c, size := utf8.DecodeRuneInString(path[i:])
+		switch {
+		case c == escape:
+			i += size
+			if i >= end {
+				return pathUnion{}, 0, eofError(path, end)
+			}
+			_, size = utf8.DecodeRuneInString(path[i:])
+		case c == quote || c == doubleQuote:
+			_, next, err := scanQuoted(path, i, end)
+			if err != nil {
+				return pathUnion{}, 0, err
+			}
+			i = next
+			continue
+		case c == leftParen || c == leftBracket || c == leftBrace:
+			depth++
+		case depth > 0 && (c == rightParen || c == rightBracket || c == rightBrace):
+			depth--
+		case c == comma && depth == 0:
+			if err := addBranch(i); err != nil {
+				return pathUnion{}, 0, err
+			}
+			branchStart = i + size
+		case c == rightBrace:
+			if err := addBranch(i); err != nil {
+				return pathUnion{}, 0, err
+			}
+			return union, i + size, nil
+		}
+		i += size
+	}
+	return pathUnion{}, 0, eofError(path, end, "','", "'}'")
+}
+
+// keyComponent returns the component represented by a given key: a
+// pathWildcard in case it is an asterisk, a pathRecursive in case it is a
+// double asterisk, a pathParent in case it is a caret, a pathIndex in case it
+// is a canonical integer, or a pathKey otherwise.
+func keyComponent(key []rune) interface{} {
+	s := string(key)
+	switch s {
+	case string(asterisk):
+		return pathWildcard{}
+	case string([]rune{asterisk, asterisk}):
+		return pathRecursive{}
+	case string(caret):
+		return pathParent{}
+	}
+	if i, err := strconv.Atoi(s); err == nil && strconv.Itoa(i) == s {
+		return pathIndex(i)
+	}
+	return pathKey(s)
+}
+
+// EscapeKey returns the provided mapping key as a path segment that always
+// refers to that exact key. Keys made only of letters, digits, underscores and
+// dashes are returned unchanged, while any other key, including the ones that
+// would be taken as indexes, is quoted.
+func EscapeKey(key string) string {
+	if _, ok := keyComponent([]rune(key)).(pathKey); ok && key != "" {
+		plain := true
+		for _, r := range key {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != minus {
+				plain = false
+				break
+			}
+		}
+		if plain {
+			return key
+		}
+	}
+	return quoteString(key)
+}
+
+// appendComponent appends a component to the provided list, collapsing
+// consecutive recursive descents, which would otherwise yield duplicated
+// matches.
+func appendComponent(list []interface{}, component interface{}) []interface{} {
+	if _, ok := component.(pathRecursive); ok && len(list) > 0 {
+		if _, ok := list[len(list)-1].(pathRecursive); ok {
+			return list
+		}
+	}
+	return append(list, component)
+}
+
+// parseBracket parses the contents of a bracket component into a pathIndex,
+// pathSlice, or pathWildcard. Returns false in case the contents are invalid.
+func parseBracket(s string) (interface{}, bool) {
+	if s == string(asterisk) {
+		return pathWildcard{}, true
+	}
+	parts := strings.Split(s, string(colon))
+	switch len(parts) {
+	case 1:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, false
+		}
+		return pathIndex(i), true
+	case 2:
+		var sl pathSlice
+		var err error
+		if parts[0] != "" {
+			if sl.Start, err = strconv.Atoi(parts[0]); err != nil {
+				return nil, false
+			}
+			sl.HasStart = true
+		}
+		if parts[1] != "" {
+			if sl.End, err = strconv.Atoi(parts[1]); err != nil {
+				return nil, false
+			}
+			sl.HasEnd = true
+		}
+		return sl, true
+	}
+	return nil, false
+}
+
+// selectorParser parses the boolean expression of a selector.
+type selectorParser struct {
+	path string
+	pos  int
+	end  int
+}
+
+// parseSelector parses a selector starting at the opening parenthesis located
+// at pos, and ending before end, returning the selector and the position right
+// after its closing parenthesis.
+func parseSelector(path string, pos, end int) (pathSelector, int, error) {
+	p := &selectorParser{path: path, pos: pos, end: end}
+	expr, err := p.parseGroup()
+	if err != nil {
+		return pathSelector{}, 0, err
+	}
+	return pathSelector{Expr: expr}, p.pos, nil
+}
+
+func (p *selectorParser) eof() bool {
+	return p.pos >= p.end
+}
+
+func (p *selectorParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(p.path[p.pos:])
+	return r
+}
+
+func (p *selectorParser) advance() rune {
+	r, size := utf8.DecodeRuneInString(p.path[p.pos:])
+	p.pos += size
+	return r
+}
+
+func (p *selectorParser) skipSpaces() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.advance()
+	}
+}
+
+// consume advances past the provided token in case the input continues with
+// it, returning whether it did so.
+func (p *selectorParser) consume(token string) bool {
+	if strings.HasPrefix(p.path[p.pos:p.end], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// expected returns an error indicating the provided tokens were expected at
+// the current position.
+func (p *selectorParser) expected(tokens ...string) error {
+	if p.eof() {
+		return eofError(p.path, p.end, tokens...)
+	}
+	return expectError(p.path, p.pos, tokens...)
+}
+
+// parseGroup parses an expression enclosed in parentheses
+func (p *selectorParser) parseGroup() (selectorExpr, error) {
+	if !p.consume(string(leftParen)) {
+		return nil, p.expected("'('")
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if !p.consume(string(rightParen)) {
+		return nil, p.expected("'&&'", "'||'", "')'")
+	}
+	return expr, nil
+}
+
+func (p *selectorParser) parseOr() (selectorExpr, error) {
+	var terms selectorOr
+	for {
+		t, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+		p.skipSpaces()
+		if !p.consume(string([]rune{pipe, pipe})) {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *selectorParser) parseAnd() (selectorExpr, error) {
+	var terms selectorAnd
+	for {
+		t, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+		p.skipSpaces()
+		if !p.consume(string([]rune{ampersand, ampersand})) {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *selectorParser) parseUnary() (selectorExpr, error) {
+	p.skipSpaces()
+	switch p.peek() {
+	case bang:
+		p.advance()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return selectorNot{Expr: expr}, nil
+	case leftParen:
+		return p.parseGroup()
+	}
+	return p.parseComparison()
+}
+
+func (p *selectorParser) parseComparison() (selectorExpr, error) {
+	key, path, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := selectorComparison{Key: key, Path: path}
+	p.skipSpaces()
+	if !p.atOperator() {
+		if p.eof() {
+			return nil, p.expected("operator", "')'")
+		}
+		// A key without an operator only tests whether it exists.
+		return selectorExists{Key: key, Path: path}, nil
+	}
+	op := selectorOperatorRunes[p.advance()]
+	if p.consume(string(equal)) {
+		switch op {
+		case opLess:
+			op = opLessEqual
+		case opGreater:
+			op = opGreaterEqual
+		}
+	}
+	cmp.Operator = op
+
+	p.skipSpaces()
+	c := p.peek()
+	switch {
+	case c == quote:
+		start := p.pos
+		if cmp.Value, err = p.parseQuoted(); err != nil {
+			return nil, err
+		}
+		cmp.Kind = KindString
+		if op == opMatch {
+			if cmp.Pattern, err = regexp.Compile(cmp.Value); err != nil {
+				return nil, makeError("invalid regular expression: "+err.Error(), p.path, start)
+			}
+		}
+	case op.isStringOperator():
+		return nil, p.expected("quote")
+	case (c >= '0' && c <= '9') || c == minus:
+		if cmp.Value, cmp.Kind, err = p.parseNumber(); err != nil {
+			return nil, err
+		}
+	case unicode.IsLetter(c):
+		start := p.pos
+		if cmp.Value, cmp.Kind, err = p.parseLiteral(); err != nil {
+			return nil, err
+		}
+		if op != opEqual && op != opNotEqual {
+			return nil, makeError(fmt.Sprintf("operator %s cannot be used with %s", op, cmp.Value), p.path, start)
+		}
+	default:
+		return nil, p.expected("quote", "number", "true", "false", "null")
+	}
+
+	return cmp, nil
+}
+
+// parseKey parses the path on the left side of a comparison, which ends at an
+// operator, closing parenthesis, or boolean operator found outside nested
+// selectors, brackets and quotes. Surrounding spaces are ignored. Returns the
+// path as written, along with its parsed components, which are empty for a
+// single dot referring to the item itself.
+func (p *selectorParser) parseKey() (string, []interface{}, error) {
+	start := p.pos
+	depth := 0
+scan:
+	for !p.eof() {
+		c := p.peek()
+		switch {
+		case c == escape:
+			p.advance()
+			if p.eof() {
+				return "", nil, eofError(p.path, p.end)
+			}
+		case c == quote || c == doubleQuote:
+			if depth == 0 && strings.TrimSpace(p.path[start:p.pos]) != "" && p.path[p.pos-1] != dot {
+				// Quotes can only start a key segment
+				return "", nil, p.expected("operator")
+			}
+			if _, err := p.parseQuoted(); err != nil {
+				return "", nil, err
+			}
+			continue
+		case c == leftParen || c == leftBracket || c == leftBrace:
+			depth++
+		case c == rightParen || c == rightBracket || c == rightBrace:
+			if depth == 0 {
+				break scan
+			}
+			depth--
+		case depth == 0 && (c == ampersand || c == pipe || p.atOperator()):
+			break scan
+		}
+		p.advance()
+	}
+
+	keyStart, keyEnd := start, p.pos
+	for keyStart < keyEnd && unicode.IsSpace(rune(p.path[keyStart])) {
+		keyStart++
+	}
+	for keyEnd > keyStart && unicode.IsSpace(rune(p.path[keyEnd-1])) {
+		keyEnd--
+	}
+	if keyStart == keyEnd {
+		return "", nil, expectError(p.path, start, "key")
+	}
+	key := p.path[keyStart:keyEnd]
+	if key == string(dot) {
+		// A single dot refers to the item itself
+		return key, nil, nil
+	}
+	if strings.HasSuffix(key, string(dot)) && !strings.HasSuffix(key, string(escape)+string(dot)) {
+		// Keys cannot end with a dot, which happens when a wildcard is
+		// read as part of an operator, as in roles.*='x'.
+		return "", nil, expectError(p.path, keyEnd, "key")
+	}
+	components, err := parseComponents(p.path, keyStart, keyEnd)
+	if err != nil {
+		return "", nil, err
+	}
+	return key, components, nil
+}
+
+// atOperator returns whether the input continues with a comparison operator.
+// Besides '=', '<' and '>', runes starting an operator are only considered
+// when followed by an equal sign, so they can still be used within keys.
+func (p *selectorParser) atOperator() bool {
+	switch p.peek() {
+	case equal, less, greater:
+		return true
+	}
+	if _, ok := selectorOperatorRunes[p.peek()]; !ok {
+		return false
+	}
+	_, size := utf8.DecodeRuneInString(p.path[p.pos:])
+	return strings.HasPrefix(p.path[p.pos+size:p.end], string(equal))
+}
+
+// parseQuoted parses a quoted value, starting at its opening quote.
+func (p *selectorParser) parseQuoted() (string, error) {
+	value, next, err := scanQuoted(p.path, p.pos, p.end)
+	if err != nil {
+		return "", err
+	}
+	p.pos = next
+	return value, nil
+}
+
+// scanQuoted scans the quoted string starting at path[pos], which is closed by
+// the same quote rune opening it before end. Returns the unescaped string, and
+// the position following its closing quote.
+func scanQuoted(path string, pos, end int) (string, int, error) {
+	delim, size := utf8.DecodeRuneInString(path[pos:])
+	var value []rune
+	escaping := false
+	for i, c := range path[pos+size : end] {
+		switch {
+		case escaping:
+			escaping = false
+		case c == escape:
+			escaping = true
+			continue
+		case c == delim:
+			return string(value), pos + size + i + utf8.RuneLen(c), nil
+		}
+		value = append(value, c)
+	}
+	return "", 0, eofError(path, end, "quote")
+}
+
+// parseNumber parses an unquoted numeric value, returning it along with its
+// Kind.
+func (p *selectorParser) parseNumber() (string, Kind, error) {
+	start := p.pos
+	for !p.eof() && strings.ContainsRune("0123456789.eE+-", p.peek()) {
+		p.advance()
+	}
+	value := p.path[start:p.pos]
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return value, KindInt, nil
+	}
+	if _, err := strconv.ParseFloat(value, 64); err != nil {
+		return "", 0, makeError("invalid number", p.path, start)
+	}
+	return value, KindFloat, nil
+}
+
+// selectorLiterals maps unquoted words accepted as selector values to their
+// Kind.
+var selectorLiterals = map[string]Kind{
+	"true":  KindBool,
+	"false": KindBool,
+	"null":  KindNull,
+}
+
+// parseLiteral parses an unquoted true, false, or null value, returning it
+// along with its Kind.
+func (p *selectorParser) parseLiteral() (string, Kind, error) {
+	start := p.pos
+	for !p.eof() && unicode.IsLetter(p.peek()) {
+		p.advance()
+	}
+	value := p.path[start:p.pos]
+	kind, ok := selectorLiterals[value]
+	if !ok {
+		return "", 0, makeError(fmt.Sprintf("unexpected '%s'", value), p.path, start)
+	}
+	return value, kind, nil
+}
+
 func makeError(message, path string, pos int) error {
-	return fmt.Errorf("could not parse:\n%s\n%s^ %s", path, strings.Repeat(" ", pos), message)
+	return &PathSyntaxError{Path: path, Offset: pos, Message: message}
+}
+
+// expectError returns an error indicating that one of the provided tokens was
+// expected at pos.
+func expectError(path string, pos int, expected ...string) error {
+	message := "expected " + expected[0]
+	if n := len(expected); n > 1 {
+		message = "expected " + strings.Join(expected[:n-1], ", ") + " or " + expected[n-1]
+	}
+	return &PathSyntaxError{Path: path, Offset: pos, Message: message, Expected: expected}
+}
+
+// eofError returns an error indicating that path ended unexpectedly at end,
+// where one of the provided tokens, if any, was expected.
+func eofError(path string, end int, expected ...string) error {
+	return &PathSyntaxError{Path: path, Offset: end - 1, Message: "unexpected EOF", Expected: expected}
 }
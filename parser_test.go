@@ -1,6 +1,7 @@
 package uyaml
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -11,7 +12,7 @@ func TestParserBasic(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, output, 3)
 	require.Equal(t, output[0], pathKey("projects"))
-	require.Equal(t, output[1], pathSelector{"project", "foo"})
+	require.Equal(t, output[1], pathSelector{selectorComparison{Key: "project", Path: []interface{}{pathKey("project")}, Value: "foo", Kind: KindString}})
 	require.Equal(t, output[2], pathKey("version"))
 }
 
@@ -27,10 +28,483 @@ func TestParserSelector(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, output, 2)
 	require.Equal(t, output[0], pathKey("projects"))
-	require.Equal(t, output[1], pathSelector{"project", "foo"})
+	require.Equal(t, output[1], pathSelector{selectorComparison{Key: "project", Path: []interface{}{pathKey("project")}, Value: "foo", Kind: KindString}})
 }
 
 func TestParserInvalid(t *testing.T) {
 	_, err := parsePath("projects(project='foo')")
 	require.Error(t, err)
 }
+
+func TestParserIndex(t *testing.T) {
+	output, err := parsePath("users.1.roles[0][2]")
+	require.NoError(t, err)
+	require.Len(t, output, 5)
+	require.Equal(t, output[0], pathKey("users"))
+	require.Equal(t, output[1], pathIndex(1))
+	require.Equal(t, output[2], pathKey("roles"))
+	require.Equal(t, output[3], pathIndex(0))
+	require.Equal(t, output[4], pathIndex(2))
+}
+
+func TestParserIndexNonCanonical(t *testing.T) {
+	output, err := parsePath("ports.08")
+	require.NoError(t, err)
+	require.Len(t, output, 2)
+	require.Equal(t, output[1], pathKey("08"))
+}
+
+func TestParserIndexInvalid(t *testing.T) {
+	_, err := parsePath("users[a]")
+	require.Error(t, err)
+
+	_, err = parsePath("users.[0]")
+	require.Error(t, err)
+
+	_, err = parsePath("users[0")
+	require.Error(t, err)
+}
+
+func TestParserNegativeIndex(t *testing.T) {
+	output, err := parsePath("users[-1].roles.-2")
+	require.NoError(t, err)
+	require.Len(t, output, 4)
+	require.Equal(t, output[1], pathIndex(-1))
+	require.Equal(t, output[3], pathIndex(-2))
+}
+
+func TestParserSlice(t *testing.T) {
+	output, err := parsePath("users[1:3].roles[:2][-1:]")
+	require.NoError(t, err)
+	require.Len(t, output, 5)
+	require.Equal(t, output[1], pathSlice{Start: 1, End: 3, HasStart: true, HasEnd: true})
+	require.Equal(t, output[3], pathSlice{End: 2, HasEnd: true})
+	require.Equal(t, output[4], pathSlice{Start: -1, HasStart: true})
+
+	_, err = parsePath("users[1:2:3]")
+	require.Error(t, err)
+}
+
+func TestParserWildcard(t *testing.T) {
+	output, err := parsePath("users.*.roles[*]")
+	require.NoError(t, err)
+	require.Len(t, output, 4)
+	require.Equal(t, output[1], pathWildcard{})
+	require.Equal(t, output[3], pathWildcard{})
+}
+
+func TestParserRecursive(t *testing.T) {
+	output, err := parsePath("spec..image")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{pathKey("spec"), pathRecursive{}, pathKey("image")}, output)
+
+	output, err = parsePath("**.image")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{pathRecursive{}, pathKey("image")}, output)
+
+	output, err = parsePath("spec...**.image")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{pathKey("spec"), pathRecursive{}, pathKey("image")}, output)
+}
+
+func TestParserSelectorOperators(t *testing.T) {
+	tests := map[string]selectorComparison{
+		"(name='josie')":  {Key: "name", Path: []interface{}{pathKey("name")}, Operator: opEqual, Value: "josie", Kind: KindString},
+		"(name!='josie')": {Key: "name", Path: []interface{}{pathKey("name")}, Operator: opNotEqual, Value: "josie", Kind: KindString},
+		"(weight>1.0)":    {Key: "weight", Path: []interface{}{pathKey("weight")}, Operator: opGreater, Value: "1.0", Kind: KindFloat},
+		"(weight>=-2)":    {Key: "weight", Path: []interface{}{pathKey("weight")}, Operator: opGreaterEqual, Value: "-2", Kind: KindInt},
+		"(priority<3)":    {Key: "priority", Path: []interface{}{pathKey("priority")}, Operator: opLess, Value: "3", Kind: KindInt},
+		"(priority<='3')": {Key: "priority", Path: []interface{}{pathKey("priority")}, Operator: opLessEqual, Value: "3", Kind: KindString},
+	}
+	for path, expected := range tests {
+		output, err := parsePath("items." + path)
+		require.NoError(t, err, path)
+		require.Len(t, output, 2, path)
+		require.Equal(t, pathSelector{expected}, output[1], path)
+	}
+}
+
+func TestParserSelectorOperatorsInvalid(t *testing.T) {
+	for _, path := range []string{"items.(a!=)", "items.(a>=x)", "items.(a<1.2.3)", "items.(>3)"} {
+		_, err := parsePath(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestParserSelectorStringOperators(t *testing.T) {
+	tests := map[string]selectorOperator{
+		"(name~='^jo')": opMatch,
+		"(name^='jo')":  opPrefix,
+		"(name$='ie')":  opSuffix,
+		"(name*='si')":  opContains,
+	}
+	for path, op := range tests {
+		output, err := parsePath("users." + path)
+		require.NoError(t, err, path)
+		require.Len(t, output, 2, path)
+		sel := output[1].(pathSelector).Expr.(selectorComparison)
+		require.Equal(t, "name", sel.Key, path)
+		require.Equal(t, op, sel.Operator, path)
+	}
+
+	output, err := parsePath("users.(name~='^jo')")
+	require.NoError(t, err)
+	require.NotNil(t, output[1].(pathSelector).Expr.(selectorComparison).Pattern)
+
+	for _, path := range []string{"users.(name~='[')", "users.(name^=3)", "users.(name~'a')"} {
+		_, err := parsePath(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestParserSelectorBoolean(t *testing.T) {
+	name := selectorComparison{Key: "name", Path: []interface{}{pathKey("name")}, Value: "josie", Kind: KindString}
+	admin := selectorComparison{Key: "admin", Path: []interface{}{pathKey("admin")}, Value: "true", Kind: KindString}
+	bot := selectorComparison{Key: "role", Path: []interface{}{pathKey("role")}, Value: "bot", Kind: KindString}
+	dummy := selectorComparison{Key: "role", Path: []interface{}{pathKey("role")}, Value: "dummy", Kind: KindString}
+
+	tests := map[string]selectorExpr{
+		"(name='josie' && admin='true')":                  selectorAnd{name, admin},
+		"(role='bot'||role='dummy')":                      selectorOr{bot, dummy},
+		"(!(role='bot'))":                                 selectorNot{bot},
+		"( ! role='bot' )":                                selectorNot{bot},
+		"(role='bot' || role='dummy' && admin='true')":    selectorOr{bot, selectorAnd{dummy, admin}},
+		"((role='bot' || role='dummy') && admin='true')":  selectorAnd{selectorOr{bot, dummy}, admin},
+		"(name='josie' && !(role='bot' || role='dummy'))": selectorAnd{name, selectorNot{selectorOr{bot, dummy}}},
+	}
+	for path, expected := range tests {
+		output, err := parsePath("users." + path + ".roles")
+		require.NoError(t, err, path)
+		require.Len(t, output, 3, path)
+		require.Equal(t, pathSelector{expected}, output[1], path)
+		require.Equal(t, pathKey("roles"), output[2], path)
+	}
+}
+
+func TestParserSelectorBooleanInvalid(t *testing.T) {
+	for _, path := range []string{
+		"users.(name='josie' &&)",
+		"users.(name='josie' & admin='true')",
+		"users.(name='josie' || )",
+		"users.((name='josie')",
+		"users.(name='josie'",
+		"users.(name='josie)",
+		"users.()",
+		"users.(!)",
+	} {
+		_, err := parsePath(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestParserSelectorString(t *testing.T) {
+	for _, path := range []string{
+		"(name='josie' && admin='true')",
+		"((role='bot' || role='dummy') && !(name='it\\'s'))",
+		"(weight>=1.5)",
+	} {
+		output, err := parsePath(path)
+		require.NoError(t, err, path)
+		require.Equal(t, path, output[0].(pathSelector).String())
+	}
+}
+
+func TestParserSelectorLiterals(t *testing.T) {
+	tests := map[string]selectorComparison{
+		"(admin=true)":   {Key: "admin", Path: []interface{}{pathKey("admin")}, Value: "true", Kind: KindBool},
+		"(admin!=false)": {Key: "admin", Path: []interface{}{pathKey("admin")}, Operator: opNotEqual, Value: "false", Kind: KindBool},
+		"(port=8080)":    {Key: "port", Path: []interface{}{pathKey("port")}, Value: "8080", Kind: KindInt},
+		"(weight=1.5)":   {Key: "weight", Path: []interface{}{pathKey("weight")}, Value: "1.5", Kind: KindFloat},
+		"(extra=null)":   {Key: "extra", Path: []interface{}{pathKey("extra")}, Value: "null", Kind: KindNull},
+		"(port='8080')":  {Key: "port", Path: []interface{}{pathKey("port")}, Value: "8080", Kind: KindString},
+	}
+	for path, expected := range tests {
+		output, err := parsePath(path)
+		require.NoError(t, err, path)
+		require.Equal(t, pathSelector{expected}, output[0], path)
+		require.Equal(t, path, output[0].(pathSelector).String(), path)
+	}
+
+	for _, path := range []string{"(admin=maybe)", "(admin>true)", "(extra<=null)", "(admin=True)"} {
+		_, err := parsePath(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestParserSelectorExistence(t *testing.T) {
+	output, err := parsePath("users.(admin).name")
+	require.NoError(t, err)
+	require.Equal(t, pathSelector{selectorExists{Key: "admin", Path: []interface{}{pathKey("admin")}}}, output[1])
+
+	output, err = parsePath("users.( !admin ).name")
+	require.NoError(t, err)
+	require.Equal(t, pathSelector{selectorNot{selectorExists{Key: "admin", Path: []interface{}{pathKey("admin")}}}}, output[1])
+	require.Equal(t, "(!admin)", output[1].(pathSelector).String())
+
+	output, err = parsePath("users.(admin && !roles || name='x')")
+	require.NoError(t, err)
+	require.Equal(t, pathSelector{selectorOr{
+		selectorAnd{selectorExists{Key: "admin", Path: []interface{}{pathKey("admin")}}, selectorNot{selectorExists{Key: "roles", Path: []interface{}{pathKey("roles")}}}},
+		selectorComparison{Key: "name", Path: []interface{}{pathKey("name")}, Value: "x", Kind: KindString},
+	}}, output[1])
+}
+
+func TestParserSelectorNestedKeys(t *testing.T) {
+	output, err := parsePath("items.(metadata.name='web').spec")
+	require.NoError(t, err)
+	require.Equal(t, pathSelector{selectorComparison{
+		Key:   "metadata.name",
+		Path:  []interface{}{pathKey("metadata"), pathKey("name")},
+		Value: "web",
+		Kind:  KindString,
+	}}, output[1])
+	require.Equal(t, pathKey("spec"), output[2])
+
+	output, err = parsePath(`items.(a\.b='x')`)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{pathKey("a.b")}, output[1].(pathSelector).Expr.(selectorComparison).Path)
+
+	output, err = parsePath("items.(spec.containers[0].image ^= 'nginx')")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{pathKey("spec"), pathKey("containers"), pathIndex(0), pathKey("image")},
+		output[1].(pathSelector).Expr.(selectorComparison).Path)
+
+	output, err = parsePath("items.(spec.containers.(name='web').ports)")
+	require.NoError(t, err)
+	require.Len(t, output[1].(pathSelector).Expr.(selectorExists).Path, 4)
+
+	for _, path := range []string{"items.(a(b)='x')", "items.(a[x]='x')", `items.(a\`} {
+		_, err := parsePath(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestParserSelectorSelf(t *testing.T) {
+	output, err := parsePath("roles.(.='bot')")
+	require.NoError(t, err)
+	require.Equal(t, pathSelector{selectorComparison{Key: ".", Value: "bot", Kind: KindString}}, output[1])
+	require.Equal(t, "(.='bot')", output[1].(pathSelector).String())
+
+	output, err = parsePath("ports.( . >= 8000 && . != 8080 )")
+	require.NoError(t, err)
+	require.Equal(t, pathSelector{selectorAnd{
+		selectorComparison{Key: ".", Operator: opGreaterEqual, Value: "8000", Kind: KindInt},
+		selectorComparison{Key: ".", Operator: opNotEqual, Value: "8080", Kind: KindInt},
+	}}, output[1])
+
+	output, err = parsePath("roles.(.*='o')")
+	require.NoError(t, err)
+	require.Equal(t, pathSelector{selectorComparison{Key: ".", Operator: opContains, Value: "o", Kind: KindString}}, output[1])
+
+	for _, path := range []string{"users.(roles.*='dummy')", "users.(roles.='dummy')"} {
+		_, err = parsePath(path)
+		var syntaxErr *PathSyntaxError
+		require.True(t, errors.As(err, &syntaxErr), path)
+		require.Equal(t, 13, syntaxErr.Offset, path)
+	}
+}
+
+func TestParserQuotedKeys(t *testing.T) {
+	cases := map[string][]interface{}{
+		`labels.'app.kubernetes.io/name'`:  {pathKey("labels"), pathKey("app.kubernetes.io/name")},
+		`labels["app.kubernetes.io/name"]`: {pathKey("labels"), pathKey("app.kubernetes.io/name")},
+		`files.'config.yaml'.mode`:         {pathKey("files"), pathKey("config.yaml"), pathKey("mode")},
+		`a.'it\'s'.b`:                      {pathKey("a"), pathKey("it's"), pathKey("b")},
+		`a."(x)"[0]`:                       {pathKey("a"), pathKey("(x)"), pathIndex(0)},
+		`a['0']`:                           {pathKey("a"), pathKey("0")},
+		`a\.b.c`:                           {pathKey("a.b"), pathKey("c")},
+		`a.it's`:                           {pathKey("a"), pathKey("it's")},
+		`'a\\b'`:                           {pathKey(`a\b`)},
+	}
+	for path, expected := range cases {
+		output, err := parsePath(path)
+		require.NoError(t, err, path)
+		require.Equal(t, expected, output, path)
+	}
+
+	output, err := parsePath(`items.(metadata.labels.'app.kubernetes.io/name'='web')`)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{pathKey("metadata"), pathKey("labels"), pathKey("app.kubernetes.io/name")},
+		output[1].(pathSelector).Expr.(selectorComparison).Path)
+
+	for _, path := range []string{`a.'b`, `a['b'`, `a['b'x]`, `a.'b'c`, `items.(a'b'='x')`} {
+		_, err := parsePath(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestEscapeKey(t *testing.T) {
+	cases := map[string]string{
+		"name":                   "name",
+		"max-retries":            "max-retries",
+		"app.kubernetes.io/name": "'app.kubernetes.io/name'",
+		"it's":                   `'it\'s'`,
+		"0":                      "'0'",
+		"*":                      "'*'",
+		"":                       "''",
+	}
+	for key, expected := range cases {
+		escaped := EscapeKey(key)
+		require.Equal(t, expected, escaped, key)
+		output, err := parsePath("a." + escaped)
+		require.NoError(t, err, key)
+		require.Equal(t, []interface{}{pathKey("a"), pathKey(key)}, output, key)
+	}
+}
+
+func TestPathSyntaxError(t *testing.T) {
+	_, err := parsePath("users[a]")
+	var syntaxErr *PathSyntaxError
+	require.True(t, errors.As(err, &syntaxErr))
+	require.Equal(t, "users[a]", syntaxErr.Path)
+	require.Equal(t, 6, syntaxErr.Offset)
+	require.Equal(t, "expected digit, '-', ':', '*', quote or ']'", syntaxErr.Message)
+	require.Equal(t, []string{"digit", "'-'", "':'", "'*'", "quote", "']'"}, syntaxErr.Expected)
+	require.Equal(t, "could not parse:\nusers[a]\n      ^ expected digit, '-', ':', '*', quote or ']'", err.Error())
+
+	_, err = parsePath("users.(name='josie'")
+	require.True(t, errors.As(err, &syntaxErr))
+	require.Equal(t, 18, syntaxErr.Offset)
+	require.Equal(t, "unexpected EOF", syntaxErr.Message)
+	require.Equal(t, []string{"'&&'", "'||'", "')'"}, syntaxErr.Expected)
+
+	_, err = parsePath("items.(metadata.labels['a'x]='web').spec")
+	require.True(t, errors.As(err, &syntaxErr))
+	require.Equal(t, "items.(metadata.labels['a'x]='web').spec", syntaxErr.Path)
+	require.Equal(t, 26, syntaxErr.Offset)
+	require.Equal(t, []string{"']'"}, syntaxErr.Expected)
+
+	_, err = parsePath("users.(admin=maybe)")
+	require.True(t, errors.As(err, &syntaxErr))
+	require.Equal(t, 13, syntaxErr.Offset)
+	require.Equal(t, "unexpected 'maybe'", syntaxErr.Message)
+	require.Empty(t, syntaxErr.Expected)
+}
+
+func TestParserUnion(t *testing.T) {
+	output, err := parsePath("metadata.{name, namespace}")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{
+		pathKey("metadata"),
+		pathUnion{Branches: [][]interface{}{{pathKey("name")}, {pathKey("namespace")}}},
+	}, output)
+
+	output, err = parsePath("spec.{replicas,containers[0].(name='a,b'),'x,y'}.z")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{
+		pathKey("spec"),
+		pathUnion{Branches: [][]interface{}{
+			{pathKey("replicas")},
+			{pathKey("containers"), pathIndex(0), pathSelector{selectorComparison{Key: "name", Path: []interface{}{pathKey("name")}, Value: "a,b", Kind: KindString}}},
+			{pathKey("x,y")},
+		}},
+		pathKey("z"),
+	}, output)
+
+	output, err = parsePath("users.(name='josie'),(name='lester'),(admin).roles")
+	require.NoError(t, err)
+	require.Len(t, output, 3)
+	require.Equal(t, "(name='josie' || name='lester' || admin)", output[1].(pathSelector).String())
+
+	for _, path := range []string{"a.{b,}", "a.{b", "a.{}", "a.(b),c", "a.(b),"} {
+		_, err := parsePath(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestParserPseudo(t *testing.T) {
+	admin := pathSelector{selectorComparison{Key: "admin", Path: []interface{}{pathKey("admin")}, Value: "true", Kind: KindString}}
+	cases := map[string][]interface{}{
+		"users.(admin='true'):first": {pathKey("users"), pathPositional{Base: admin, Pseudo: pseudoFirst}},
+		"roles:last":                 {pathKey("roles"), pathPositional{Base: pathWildcard{}, Pseudo: pseudoLast}},
+		"items:nth(3).name":          {pathKey("items"), pathPositional{Base: pathWildcard{}, Pseudo: pseudoNth, N: 3}, pathKey("name")},
+		"items[1:]:even":             {pathKey("items"), pathPositional{Base: pathSlice{Start: 1, HasStart: true}, Pseudo: pseudoEven}},
+		"items.*:odd:last":           {pathKey("items"), pathPositional{Base: pathPositional{Base: pathWildcard{}, Pseudo: pseudoOdd}, Pseudo: pseudoLast}},
+		"'a.b':first[0]":             {pathKey("a.b"), pathPositional{Base: pathWildcard{}, Pseudo: pseudoFirst}, pathIndex(0)},
+		"a:b.c:firsts":               {pathKey("a:b"), pathKey("c:firsts")},
+		`a\:first`:                   {pathKey("a:first")},
+	}
+	for path, expected := range cases {
+		output, err := parsePath(path)
+		require.NoError(t, err, path)
+		require.Equal(t, expected, output, path)
+	}
+
+	for _, path := range []string{"items:nth(0)", "items:nth(x)", "items:nth(1", "items.(a):second", "items[0]:"} {
+		_, err := parsePath(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestParserFunctions(t *testing.T) {
+	cases := map[string][]interface{}{
+		"users.length()":         {pathKey("users"), funcLength},
+		"spec.keys()":            {pathKey("spec"), funcKeys},
+		"users.0.weight.type()":  {pathKey("users"), pathIndex(0), pathKey("weight"), funcType},
+		"length":                 {pathKey("length")},
+		"'length'.keys()":        {pathKey("length"), funcKeys},
+		"users.(roles.length())": nil,
+	}
+	for path, expected := range cases {
+		output, err := parsePath(path)
+		require.NoError(t, err, path)
+		if expected != nil {
+			require.Equal(t, expected, output, path)
+		}
+	}
+
+	for _, path := range []string{"users.length().x", "users.length()[0]", "users.size()", "users.length(1)"} {
+		_, err := parsePath(path)
+		require.Error(t, err, path)
+	}
+}
+
+func TestParserParent(t *testing.T) {
+	output, err := parsePath("spec.containers.(image='nginx').^.^")
+	require.NoError(t, err)
+	require.Len(t, output, 5)
+	require.Equal(t, pathParent{}, output[3])
+	require.Equal(t, pathParent{}, output[4])
+
+	output, err = parsePath(`a.\^.'^'`)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{pathKey("a"), pathKey("^"), pathKey("^")}, output)
+
+	output, err = parsePath("items.(^.kind='List')")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{pathParent{}, pathKey("kind")}, output[1].(pathSelector).Expr.(selectorComparison).Path)
+}
+
+func TestPointerConversion(t *testing.T) {
+	for pointer, expected := range map[string]string{
+		"/users/0/roles/1":                "users[0].roles[1]",
+		"/labels/app.kubernetes.io~1name": `labels.'app.kubernetes.io/name'`,
+		"/a~0b/01":                        "'a~b'.01",
+		"/":                               "''",
+	} {
+		path, err := PointerToPath(pointer)
+		require.NoError(t, err, pointer)
+		require.Equal(t, expected, path, pointer)
+
+		back, err := PathToPointer(path)
+		require.NoError(t, err, path)
+		require.Equal(t, pointer, back, path)
+	}
+
+	for _, pointer := range []string{"users", "/a~2b", "/a~"} {
+		_, err := PointerToPath(pointer)
+		var syntaxErr *PathSyntaxError
+		require.True(t, errors.As(err, &syntaxErr), pointer)
+	}
+
+	_, err := PointerToPath("")
+	require.True(t, errors.Is(err, ErrEmptyPath))
+
+	_, err = PointerToPath("/users/-")
+	require.Error(t, err)
+
+	for _, path := range []string{"users.*.name", "users[-1]", "users.(name='josie')", "users..name"} {
+		_, err := PathToPointer(path)
+		require.Error(t, err, path)
+	}
+}
@@ -0,0 +1,42 @@
+package uyaml
+
+// Path represents a parsed path, which can be evaluated any number of times
+// against documents and elements without being parsed again. Paths are
+// obtained through CompilePath or MustCompilePath, and are safe for concurrent
+// use.
+type Path struct {
+	raw        string
+	components []interface{}
+}
+
+// CompilePath parses the provided path, returning a Path that can be used with
+// methods such as Document.DigPath, Document.SetPath and Document.RemovePath.
+// Returns an error in case the path cannot be parsed.
+func CompilePath(path string) (Path, error) {
+	components, err := parsePath(path)
+	if err != nil {
+		return Path{}, err
+	}
+	return Path{raw: path, components: components}, nil
+}
+
+// MustCompilePath works just like CompilePath, but panics in case the provided
+// path cannot be parsed.
+func MustCompilePath(path string) Path {
+	p, err := CompilePath(path)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the path the receiver was compiled from
+func (p Path) String() string {
+	return p.raw
+}
+
+// empty returns whether the receiver holds no components, which is the case
+// for the zero Path.
+func (p Path) empty() bool {
+	return len(p.components) == 0
+}
@@ -0,0 +1,155 @@
+package uyaml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathAppend represents the - token of JSON Pointers, which refers to the
+// position past the end of a sequence, or to the - key of a mapping.
+type pathAppend struct{}
+
+// appendToken is the JSON Pointer token referring to the position past the
+// end of a sequence.
+const appendToken = "-"
+
+// compilePointer returns a Path referring to the same location as the
+// provided JSON Pointer (RFC 6901). The root pointer, an empty string, results
+// in an empty Path.
+func compilePointer(pointer string) (Path, error) {
+	if pointer == "" {
+		return Path{}, nil
+	}
+	if pointer[0] != '/' {
+		return Path{}, expectError(pointer, 0, "/")
+	}
+
+	b := NewPath()
+	var components []interface{}
+	pos := 1
+	for _, token := range strings.Split(pointer[1:], "/") {
+		key, err := unescapePointerToken(pointer, pos, token)
+		if err != nil {
+			return Path{}, err
+		}
+		pos += len(token) + 1
+
+		if idx, ok := pointerIndex(key); ok {
+			b.Index(idx)
+			components = append(components, pathIndex(idx))
+		} else if key == appendToken {
+			b.Key(key)
+			components = append(components, pathAppend{})
+		} else {
+			b.Key(key)
+			components = append(components, pathKey(key))
+		}
+	}
+	return Path{raw: b.String(), components: components}, nil
+}
+
+// unescapePointerToken replaces the ~0 and ~1 escape sequences found in the
+// provided token, which starts at pos within pointer, by ~ and / respectively.
+func unescapePointerToken(pointer string, pos int, token string) (string, error) {
+	if !strings.ContainsRune(token, '~') {
+		return token, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(token); i++ {
+		if token[i] != '~' {
+			b.WriteByte(token[i])
+			continue
+		}
+		if i+1 == len(token) {
+			return "", eofError(pointer, pos+i+1, "0", "1")
+		}
+		switch token[i+1] {
+		case '0':
+			b.WriteByte('~')
+		case '1':
+			b.WriteByte('/')
+		default:
+			return "", expectError(pointer, pos+i+1, "0", "1")
+		}
+		i++
+	}
+	return b.String(), nil
+}
+
+// pointerIndex returns the array index represented by the provided pointer
+// token. As required by RFC 6901, only non-negative integers without leading
+// zeros are considered indexes.
+func pointerIndex(token string) (int, bool) {
+	if token == "" || (token[0] == '0' && len(token) > 1) {
+		return 0, false
+	}
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, false
+	}
+	return idx, true
+}
+
+// escapePointerToken escapes ~ and / characters found in the provided key.
+func escapePointerToken(key string) string {
+	key = strings.ReplaceAll(key, "~", "~0")
+	return strings.ReplaceAll(key, "/", "~1")
+}
+
+// PointerToPath converts the provided JSON Pointer (RFC 6901), such as
+// /users/0/roles, into an equivalent path, such as users[0].roles. Returns a
+// *PathSyntaxError in case the pointer cannot be parsed. As paths cannot be
+// empty, the root pointer results in ErrEmptyPath. Pointers using the - token,
+// which refers to the position past the end of a sequence, have no equivalent
+// path either.
+func PointerToPath(pointer string) (string, error) {
+	p, err := compilePointer(pointer)
+	if err != nil {
+		return "", err
+	}
+	if p.empty() {
+		return "", fmt.Errorf("%w: the root pointer has no equivalent path", ErrEmptyPath)
+	}
+	for _, c := range p.components {
+		if _, ok := c.(pathAppend); ok {
+			return "", fmt.Errorf("pointer %s cannot be converted to a path: the %s token has no equivalent", pointer, appendToken)
+		}
+	}
+	return p.String(), nil
+}
+
+// PathToPointer converts the provided path into an equivalent JSON Pointer
+// (RFC 6901). Only paths composed of keys and non-negative positions can be
+// converted, as pointers refer to a single location.
+func PathToPointer(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("%w provided to PathToPointer", ErrEmptyPath)
+	}
+	components, err := parsePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, c := range components {
+		b.WriteByte('/')
+		switch v := c.(type) {
+		case pathKey:
+			b.WriteString(escapePointerToken(string(v)))
+		case pathIndex:
+			if v < 0 {
+				return "", fmt.Errorf("path %s cannot be converted to a pointer: negative positions are not supported", path)
+			}
+			b.WriteString(strconv.Itoa(int(v)))
+		default:
+			return "", fmt.Errorf("path %s cannot be converted to a pointer: only keys and positions are supported", path)
+		}
+	}
+	return b.String(), nil
+}
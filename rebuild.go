@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"gopkg.in/yaml.v3"
 	"reflect"
+	"sort"
 	"strconv"
 )
 
@@ -15,9 +16,17 @@ func findRoot(el *Element) *yaml.Node {
 	return p.value
 }
 
+// builtNode wraps nodes built by the package itself, which buildNode places
+// as they are. Nodes provided by callers are never linked into documents.
+type builtNode struct {
+	n *yaml.Node
+}
+
 func buildNode(val interface{}) (*yaml.Node, error) {
 	n := &yaml.Node{}
 	switch v := val.(type) {
+	case builtNode:
+		return v.n, nil
 	case string:
 		n.Tag = "!!str"
 		n.Kind = yaml.ScalarNode
@@ -92,11 +101,17 @@ func buildNode(val interface{}) (*yaml.Node, error) {
 			n.Content = nodeArr
 		} else if t.Kind() == reflect.Map {
 			keys := reflectedValue.MapKeys()
-			var nodeArr []*yaml.Node
 			for _, k := range keys {
 				if k.Kind() != reflect.String {
 					return nil, fmt.Errorf("could not create map with unsupported key type %s", k.Kind())
 				}
+			}
+			// Sort keys so maps are always encoded in the same order
+			sort.Slice(keys, func(i, j int) bool {
+				return keys[i].String() < keys[j].String()
+			})
+			var nodeArr []*yaml.Node
+			for _, k := range keys {
 				key, err := buildNode(k.String())
 				if err != nil {
 					return nil, err
@@ -119,167 +134,401 @@ func buildNode(val interface{}) (*yaml.Node, error) {
 	return n, nil
 }
 
-func set(root *yaml.Node, path string, value interface{}) (*Element, error) {
-	// Node exists?
-	ok, v, err := search(path, root)
+func set(root *yaml.Node, path string, value interface{}, opts SetOptions) (*Element, error) {
+	composed, err := parsePath(path)
 	if err != nil {
 		return nil, err
 	}
-	if ok {
-		if n, err := v.Replace(value); err != nil {
+	return setComponents(rootElement(root), composed, value, opts)
+}
+
+func setPath(root *yaml.Node, p Path, value interface{}, opts SetOptions) (*Element, error) {
+	if p.empty() {
+		return nil, fmt.Errorf("%w provided to SetPath", ErrEmptyPath)
+	}
+	return setComponents(rootElement(root), p.components, value, opts)
+}
+
+// setComponents sets value under the provided path components, relative to el.
+// Existing items are replaced, and missing structures are created. Only the
+// first match of each component is followed.
+func setComponents(el *Element, composed []interface{}, value interface{}, opts SetOptions) (*Element, error) {
+	if len(composed) == 0 {
+		return el.Replace(value)
+	}
+
+	if opts.Aliases == AliasCopy && el.value.Kind == yaml.AliasNode {
+		// The anchored value is copied in place of the alias, so changes
+		// below it leave the original untouched.
+		*el.value = *detachedCopy(resolveAlias(el.value))
+	}
+
+	if _, ok := composed[0].(pathRecursive); ok {
+		// Recursive descents have no sensible place to create missing
+		// structures in, so only the first existing item is replaced.
+		matches := applySearch(composed, el, MatchOptions{})
+		if len(matches) == 0 {
+			return nil, ErrNotFound
+		}
+		return matches[0].Replace(value)
+	}
+
+	if u, ok := composed[0].(pathUnion); ok {
+		// Only the first branch matching an item is followed, or the first
+		// branch, in case none does.
+		branch := u.Branches[0]
+		for _, b := range u.Branches {
+			if len(applySearch(b, el, MatchOptions{})) > 0 {
+				branch = b
+				break
+			}
+		}
+		path := append(append([]interface{}{}, branch...), composed[1:]...)
+		return setComponents(el, path, value, opts)
+	}
+
+	matches := applyComponent(composed[0], el, MatchOptions{})
+	if len(matches) == 0 {
+		// At this point, el does not have path components for composed
+		if err := buildAndSet(el.node(), el, firstBranches(composed), value); err != nil {
 			return nil, err
-		} else {
-			return n, nil
 		}
+		return el, nil
 	}
 
-	// At this point, node does not exist at some point. Iterate until we have
-	// all structures in place.
-	composed, err := parsePath(path)
-	if err != nil {
-		return nil, err
+	// Just like Remove, only the first match is changed
+	m := matches[0]
+	if len(composed) > 1 && m.merged() {
+		// Values provided by merge keys are copied into the mapping before
+		// being changed, leaving the merged source untouched.
+		c, err := m.Replace(builtNode{detachedCopy(m.value)})
+		if err != nil {
+			return nil, err
+		}
+		m = c
 	}
-	obj := root
-	el := element(root)
-
-	for i, v := range composed {
-		switch t := v.(type) {
-		case pathKey:
-			if v, ok := applyPathKey(t, obj); ok {
-				nel := element(v)
-				nel.parent = el
-				obj = v
-				el = nel
-			} else {
-				// At this point, el does not have path components for
-				// composed[i:]
-				if err = buildAndSet(el, composed[i:], value); err != nil {
-					return nil, err
-				}
-				return el, nil
-			}
-		case pathSelector:
-			if v, ok := applyPathSelector(t, obj); ok {
-				nel := element(v)
-				nel.parent = el
-				obj = v
-				el = nel
-			} else {
-				// At this point, el does not have path components for
-				// composed[i:]
-				if err = buildAndSet(el, composed[i:], value); err != nil {
-					return nil, err
-				}
-				return el, nil
+	return setComponents(m, composed[1:], value, opts)
+}
+
+// firstBranches returns the provided components with each union replaced by
+// the components of its first branch.
+func firstBranches(composed []interface{}) []interface{} {
+	result := make([]interface{}, 0, len(composed))
+	for _, c := range composed {
+		if u, ok := c.(pathUnion); ok {
+			result = append(result, firstBranches(u.Branches[0])...)
+			continue
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// buildAndSet creates the structure described by path under obj, the node
+// referred to by el, placing value at its end.
+func buildAndSet(obj *yaml.Node, el *Element, path []interface{}, value interface{}) error {
+	if _, ok := path[0].(pathAppend); ok {
+		switch obj.Kind {
+		case yaml.SequenceNode:
+			return setIndex(obj, len(obj.Content), path[1:], value)
+		case yaml.MappingNode:
+			path = append([]interface{}{pathKey(appendToken)}, path[1:]...)
+		}
+	}
+
+	if idx, ok := path[0].(pathIndex); ok {
+		switch obj.Kind {
+		case yaml.SequenceNode:
+			if idx < 0 {
+				return fmt.Errorf("%w: index %d for sequence of length %d", ErrOutOfRange, idx, len(obj.Content))
 			}
+			return setIndex(obj, int(idx), path[1:], value)
+		case yaml.MappingNode:
+			// Numeric components address regular keys within mappings
+			path = append([]interface{}{pathKey(strconv.Itoa(int(idx)))}, path[1:]...)
 		}
 	}
 
-	return nil, bug("Unexpected state for set function, should have returned from the previous loop")
-}
+	_, isKey := path[0].(pathKey)
+	_, isSelector := path[0].(pathSelector)
+	switch {
+	case obj.Kind == yaml.ScalarNode && !el.IsNull():
+		// Scalars cannot hold other values
+		expected := KindSlice
+		if isKey {
+			expected = KindMap
+		}
+		return el.typeMismatch(expected)
+	case obj.Kind == yaml.SequenceNode && isKey:
+		// Sequence items are addressed by positions and selectors
+		return el.typeMismatch(KindMap)
+	case obj.Kind == yaml.MappingNode && isSelector:
+		// Mapping values created through selectors would lack a key
+		return el.typeMismatch(KindSlice)
+	}
 
-func buildAndSet(el *Element, path []interface{}, value interface{}) error {
 	e, err := buildStructure(path, value)
 	if err != nil {
 		return err
 	}
-	if el.value.Kind == yaml.DocumentNode {
-		innerEl := el.value.Content[0]
-		innerEl.Content = append(innerEl.Content, e.value.Content...)
+	if obj.Kind == 0 || obj.Kind == yaml.DocumentNode {
+		// Empty documents take the new structure as their root
+		obj.Kind = yaml.DocumentNode
+		obj.Content = append(obj.Content, e.value)
+	} else if el.IsNull() {
+		// Null values (for instance, the ones used to pad sequences) are
+		// replaced in place by the new structure.
+		*obj = *e.value
 	} else {
-		if el.Kind() == e.Kind() {
+		if obj.Kind == e.value.Kind {
 			// ...merge?
-			el.value.Content = append(el.value.Content, e.value.Content...)
+			obj.Content = append(obj.Content, e.value.Content...)
 		} else {
 			// ...append?
-			el.value.Content = append(el.value.Content, e.value)
+			obj.Content = append(obj.Content, e.value)
 		}
 	}
 
 	return nil
 }
 
+// setIndex extends a given sequence node with null items until it is able to
+// hold an item at idx, and places the provided value under it, using path to
+// create any required structure.
+func setIndex(seq *yaml.Node, idx int, path []interface{}, value interface{}) error {
+	if err := checkPadding(seq, idx); err != nil {
+		return err
+	}
+
+	var n *yaml.Node
+	if len(path) == 0 {
+		v, err := buildNode(value)
+		if err != nil {
+			return err
+		}
+		n = v
+	} else {
+		e, err := buildStructure(path, value)
+		if err != nil {
+			return err
+		}
+		n = e.value
+	}
+
+	padSequence(seq, idx)
+	seq.Content = append(seq.Content, n)
+	return nil
+}
+
+// MaxSequencePadding is the largest number of null items Set adds to a
+// sequence in order to place a value past its end.
+const MaxSequencePadding = 1000
+
+// checkPadding returns an error in case padding the provided sequence node up
+// to size requires more than MaxSequencePadding null items.
+func checkPadding(seq *yaml.Node, size int) error {
+	if size-len(seq.Content) > MaxSequencePadding {
+		return fmt.Errorf("%w: position %d is more than %d items past the end of a sequence of length %d", ErrOutOfRange, size, MaxSequencePadding, len(seq.Content))
+	}
+	return nil
+}
+
+// padSequence appends null items to the provided sequence node until its
+// length reaches size. checkPadding must be used beforehand to limit the
+// number of items added.
+func padSequence(seq *yaml.Node, size int) {
+	for len(seq.Content) < size {
+		seq.Content = append(seq.Content, &yaml.Node{
+			Kind:  yaml.ScalarNode,
+			Tag:   "!!null",
+			Value: "null",
+		})
+	}
+}
+
 func buildStructure(components []interface{}, value interface{}) (*Element, error) {
 	if len(components) == 0 {
 		return nil, bug("buildStructure received an empty components slice")
 	}
 
-	// Take the last component, and create it.
-	lastComp := components[len(components)-1]
-	elementBase, err := buildNode(value)
+	n, err := buildNode(value)
 	if err != nil {
 		return nil, err
 	}
 
-	var baseValue []*yaml.Node
-	if sel, ok := lastComp.(pathSelector); ok {
-		k := sel.Key
-		v := sel.Value
-		elementBase.Content = append([]*yaml.Node{
-			{
-				Kind:  yaml.ScalarNode,
-				Tag:   "!!str",
-				Value: k,
-			},
-			{
-				Kind:  yaml.ScalarNode,
-				Tag:   "!!str",
-				Value: v,
-			},
-		}, elementBase.Content...)
-		baseValue = []*yaml.Node{
-			{
-				Kind:    yaml.SequenceNode,
-				Tag:     "!!seq",
-				Content: []*yaml.Node{elementBase},
-				Column:  0,
-			},
+	// Wrap the value from the innermost component outwards.
+	for i := len(components) - 1; i >= 0; i-- {
+		if n, err = wrapNode(components[i], n); err != nil {
+			return nil, err
 		}
-	} else {
-		baseValue = []*yaml.Node{
-			{
-				Kind: yaml.MappingNode,
-				Tag:  "!!map",
-				Content: []*yaml.Node{
-					{
-						Kind:  yaml.ScalarNode,
-						Tag:   "!!str",
-						Value: string(lastComp.(pathKey)),
-					},
-					elementBase,
-				},
-			},
+	}
+
+	return element(n), nil
+}
+
+// selectorAssignments returns the equality comparisons that must hold for an
+// item to satisfy the provided expression. Returns false in case the
+// expression cannot be satisfied by assigning values to keys.
+func selectorAssignments(expr selectorExpr) ([]selectorComparison, bool) {
+	switch e := expr.(type) {
+	case selectorComparison:
+		return []selectorComparison{e}, e.Operator == opEqual
+	case selectorAnd:
+		var result []selectorComparison
+		for _, t := range e {
+			a, ok := selectorAssignments(t)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, a...)
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// copyNode returns a deep copy of the provided node
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+// detachedCopy returns a deep copy of the provided node without any anchors,
+// so the copy does not redefine anchors present in the original.
+func detachedCopy(n *yaml.Node) *yaml.Node {
+	c := copyNode(n)
+	clearAnchors(c)
+	return c
+}
+
+// clearAnchors removes anchors from the provided node and its descendants.
+func clearAnchors(n *yaml.Node) {
+	n.Anchor = ""
+	for _, child := range n.Content {
+		clearAnchors(child)
+	}
+}
+
+// mergeMappings merges the entries of the src mapping into dst. Values
+// present under the same key in both mappings are merged recursively when both
+// are mappings, and replaced by the ones in src otherwise.
+func mergeMappings(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		k, v := src.Content[i], src.Content[i+1]
+		existing, ok := applyPathKey(pathKey(k.Value), dst, MatchOptions{})
+		switch {
+		case !ok:
+			dst.Content = append(dst.Content, k, v)
+		case existing.Kind == yaml.MappingNode && v.Kind == yaml.MappingNode:
+			mergeMappings(existing, v)
+		default:
+			*existing = *v
 		}
 	}
+}
 
-	components = components[:len(components)-1]
-	for _, rv := range components {
-		switch v := rv.(type) {
-		case pathKey:
-			baseValue = []*yaml.Node{
+// wrapNode returns a new node representing the provided path component
+// holding n.
+func wrapNode(component interface{}, n *yaml.Node) (*yaml.Node, error) {
+	switch v := component.(type) {
+	case pathKey:
+		return &yaml.Node{
+			Kind: yaml.MappingNode,
+			Tag:  "!!map",
+			Content: []*yaml.Node{
 				{
-					Kind: yaml.MappingNode,
-					Tag:  "!!map",
-					Content: append([]*yaml.Node{
-						{
-							Kind:  yaml.ScalarNode,
-							Tag:   "!!str",
-							Value: string(v),
-						},
-					},
-						baseValue...),
+					Kind:  yaml.ScalarNode,
+					Tag:   "!!str",
+					Value: string(v),
 				},
+				n,
+			},
+		}, nil
+	case pathSelector:
+		assignments, ok := selectorAssignments(v.Expr)
+		if !ok {
+			return nil, fmt.Errorf("cannot create item matching selector %s: only equality conditions joined by && describe a new item", v)
+		}
+		for _, a := range assignments {
+			if len(a.Path) > 0 {
+				continue
 			}
-		case pathSelector:
-			baseValue = []*yaml.Node{
-				{
-					Kind:    yaml.SequenceNode,
-					Tag:     "!!seq",
-					Content: baseValue,
-				},
+			// Items compared by their own value are created from the
+			// selector's value, which the provided one must match.
+			if len(assignments) > 1 {
+				return nil, fmt.Errorf("cannot create item matching selector %s: conditions on the item itself cannot be combined with other conditions", v)
 			}
+			if n.Tag == "!!null" {
+				n = a.literalNode()
+			}
+			if !v.matches(n, MatchOptions{}) {
+				return nil, fmt.Errorf("cannot create item matching selector %s: the provided value conflicts with its conditions", v)
+			}
+			return &yaml.Node{
+				Kind:    yaml.SequenceNode,
+				Tag:     "!!seq",
+				Content: []*yaml.Node{n},
+			}, nil
+		}
+		if n.Tag == "!!null" {
+			n = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		if n.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("cannot create item matching selector %s from a non-map value", v)
+		}
+		item := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, a := range assignments {
+			if _, err := setComponents(element(item), a.Path, builtNode{a.literalNode()}, SetOptions{}); err != nil {
+				return nil, err
+			}
+		}
+		mergeMappings(item, n)
+		if !v.matches(item, MatchOptions{}) {
+			return nil, fmt.Errorf("cannot create item matching selector %s: the provided value conflicts with its conditions", v)
+		}
+		n = item
+		return &yaml.Node{
+			Kind:    yaml.SequenceNode,
+			Tag:     "!!seq",
+			Content: []*yaml.Node{n},
+		}, nil
+	case pathIndex:
+		if v < 0 {
+			return nil, fmt.Errorf("%w: cannot create item for negative index %d", ErrOutOfRange, v)
+		}
+		seq := &yaml.Node{
+			Kind: yaml.SequenceNode,
+			Tag:  "!!seq",
+		}
+		if err := checkPadding(seq, int(v)); err != nil {
+			return nil, err
 		}
+		padSequence(seq, int(v))
+		seq.Content = append(seq.Content, n)
+		return seq, nil
+	case pathSlice:
+		return nil, fmt.Errorf("cannot create items for slice components")
+	case pathWildcard:
+		return nil, fmt.Errorf("cannot create items for wildcard components")
+	case pathRecursive:
+		return nil, fmt.Errorf("cannot create items for recursive descent components")
+	case pathPositional:
+		return nil, fmt.Errorf("cannot create items for positional pseudo-selectors")
+	case pathParent:
+		return nil, fmt.Errorf("cannot create items for parent steps")
+	case pathAppend:
+		return &yaml.Node{
+			Kind:    yaml.SequenceNode,
+			Tag:     "!!seq",
+			Content: []*yaml.Node{n},
+		}, nil
+	case pathFunction:
+		return nil, fmt.Errorf("cannot set values computed by %s()", v)
 	}
 
-	return element(baseValue[0]), nil
+	return nil, bug("wrapNode received an unexpected component %T", component)
 }
@@ -0,0 +1,267 @@
+package uyaml
+
+import (
+	"gopkg.in/yaml.v3"
+	"strconv"
+	"strings"
+)
+
+var selectorOperatorString = map[selectorOperator]string{
+	opEqual:        "=",
+	opNotEqual:     "!=",
+	opLess:         "<",
+	opLessEqual:    "<=",
+	opGreater:      ">",
+	opGreaterEqual: ">=",
+	opMatch:        "~=",
+	opPrefix:       "^=",
+	opSuffix:       "$=",
+	opContains:     "*=",
+}
+
+func (o selectorOperator) String() string {
+	return selectorOperatorString[o]
+}
+
+func (s pathSelector) String() string {
+	return "(" + s.Expr.String() + ")"
+}
+
+func (s selectorComparison) String() string {
+	value := s.Value
+	if s.Kind == KindString {
+		value = quoteString(value)
+	}
+	return s.Key + s.Operator.String() + value
+}
+
+func (s selectorExists) String() string {
+	return s.Key
+}
+
+func (s selectorAnd) String() string {
+	return joinSelectorExprs(s, " && ")
+}
+
+func (s selectorOr) String() string {
+	return joinSelectorExprs(s, " || ")
+}
+
+func (s selectorNot) String() string {
+	if _, ok := s.Expr.(selectorExists); ok {
+		return "!" + s.Expr.String()
+	}
+	return "!(" + s.Expr.String() + ")"
+}
+
+// joinSelectorExprs joins the string representation of the provided
+// expressions using sep. Compound expressions are wrapped in parentheses.
+func joinSelectorExprs(exprs []selectorExpr, sep string) string {
+	parts := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		switch e.(type) {
+		case selectorAnd, selectorOr:
+			parts = append(parts, "("+e.String()+")")
+		default:
+			parts = append(parts, e.String())
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// quoteString wraps the provided value in quotes, escaping any quotes
+// and backslashes it contains.
+func quoteString(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "'", `\'`)
+	return "'" + v + "'"
+}
+
+// matches returns whether the provided item satisfies the receiver's
+// expression.
+func (s pathSelector) matches(item *yaml.Node, opts MatchOptions) bool {
+	return s.Expr.matches(item, opts)
+}
+
+func (s selectorExists) matches(item *yaml.Node, opts MatchOptions) bool {
+	return len(applySearch(s.Path, element(item), opts)) > 0
+}
+
+func (s selectorAnd) matches(item *yaml.Node, opts MatchOptions) bool {
+	for _, e := range s {
+		if !e.matches(item, opts) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s selectorOr) matches(item *yaml.Node, opts MatchOptions) bool {
+	for _, e := range s {
+		if e.matches(item, opts) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s selectorNot) matches(item *yaml.Node, opts MatchOptions) bool {
+	return !s.Expr.matches(item, opts)
+}
+
+// matches returns whether the provided item satisfies the receiver. When the
+// receiver's key resolves to several nodes, the item matches if any of them
+// satisfies the comparison; for !=, none of them may equal the value. Items
+// lacking the key only satisfy !=, so (a!='b') is equivalent to !(a='b').
+func (s selectorComparison) matches(item *yaml.Node, opts MatchOptions) bool {
+	els := applySearch(s.Path, element(item), opts)
+	if len(els) == 0 {
+		return s.Operator == opNotEqual
+	}
+
+	if s.Operator == opNotEqual {
+		for _, el := range els {
+			if s.equals(el.node()) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, el := range els {
+		if s.compareNode(el.node()) {
+			return true
+		}
+	}
+	return false
+}
+
+// literalNode returns a new scalar node holding the receiver's value.
+func (s selectorComparison) literalNode() *yaml.Node {
+	return &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   kindToTag[s.Kind],
+		Value: s.Value,
+	}
+}
+
+// compareNode returns whether the provided node satisfies the receiver's
+// operator.
+func (s selectorComparison) compareNode(n *yaml.Node) bool {
+	switch s.Operator {
+	case opEqual:
+		return s.equals(n)
+	case opMatch, opPrefix, opSuffix, opContains:
+		return s.matchString(n)
+	}
+
+	cmp, ok := s.compare(n)
+	if !ok {
+		return false
+	}
+	switch s.Operator {
+	case opLess:
+		return cmp < 0
+	case opLessEqual:
+		return cmp <= 0
+	case opGreater:
+		return cmp > 0
+	case opGreaterEqual:
+		return cmp >= 0
+	}
+	return false
+}
+
+// matchString applies the receiver's string operator to the raw value of the
+// provided node. Only scalar nodes can be matched.
+func (s selectorComparison) matchString(n *yaml.Node) bool {
+	if n.Kind != yaml.ScalarNode {
+		return false
+	}
+	switch s.Operator {
+	case opMatch:
+		return s.Pattern.MatchString(n.Value)
+	case opPrefix:
+		return strings.HasPrefix(n.Value, s.Value)
+	case opSuffix:
+		return strings.HasSuffix(n.Value, s.Value)
+	case opContains:
+		return strings.Contains(n.Value, s.Value)
+	}
+	return false
+}
+
+// equals returns whether the provided node is equal to the receiver's value.
+// Quoted values are compared against the node's raw value, while unquoted
+// literals only match nodes of the same Kind.
+func (s selectorComparison) equals(n *yaml.Node) bool {
+	switch s.Kind {
+	case KindInt, KindFloat:
+		cmp, ok := s.compare(n)
+		return ok && cmp == 0
+	case KindBool:
+		ok, v := boolValue(n)
+		return ok && v == (s.Value == "true")
+	case KindNull:
+		return element(n).IsNull()
+	}
+	return n.Value == s.Value
+}
+
+// boolValue returns whether the provided node represents a boolean, and its
+// value. Besides nodes tagged as booleans, plain scalars using one of the
+// spellings in yamlBool (such as yes or off) are also considered booleans.
+func boolValue(n *yaml.Node) (bool, bool) {
+	el := element(n)
+	switch el.Kind() {
+	case KindBool:
+		return el.Bool()
+	case KindString:
+		if n.Style != 0 && n.Style != yaml.TaggedStyle {
+			return false, false
+		}
+		for _, v := range yamlBoolTrue {
+			if v == n.Value {
+				return true, true
+			}
+		}
+		for _, v := range yamlBoolFalse {
+			if v == n.Value {
+				return true, false
+			}
+		}
+	}
+	return false, false
+}
+
+// compare compares the provided node against the receiver's value, returning
+// a negative number, zero, or a positive number in case the node is
+// respectively lesser than, equal to, or greater than the value. Numeric nodes
+// are compared numerically against values that can be parsed as numbers, and
+// string nodes are compared lexicographically against quoted values. Returns
+// false in case the node and value cannot be compared.
+func (s selectorComparison) compare(n *yaml.Node) (int, bool) {
+	el := element(n)
+	if ok, v := el.Float(); ok {
+		if s.Kind != KindString && s.Kind != KindInt && s.Kind != KindFloat {
+			return 0, false
+		}
+		lit, err := strconv.ParseFloat(s.Value, 64)
+		if err != nil {
+			return 0, false
+		}
+		switch {
+		case v < lit:
+			return -1, true
+		case v > lit:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	if ok, v := el.String(); ok && s.Kind == KindString {
+		return strings.Compare(v, s.Value), true
+	}
+
+	return 0, false
+}
@@ -1,84 +1,339 @@
 package uyaml
 
-import "gopkg.in/yaml.v3"
+import (
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
 
-func search(path string, obj *yaml.Node) (bool, *Element, error) {
+func search(path string, from *Element, opts MatchOptions) ([]*Element, error) {
 	composed, err := parsePath(path)
 	if err != nil {
-		return false, nil, err
+		return nil, err
 	}
 
-	ok, res := applySearch(composed, obj)
-	return ok, res, nil
+	return applySearch(composed, from, opts), nil
 }
 
-func applyPathKey(t pathKey, obj *yaml.Node) (*yaml.Node, bool) {
-	if obj.Kind == yaml.DocumentNode {
-		for _, v := range obj.Content {
-			if n, ok := applyPathKey(t, v); ok {
-				return n, ok
-			}
+// rootElement returns an Element for the provided node. Documents are
+// unwrapped into their root value, which retains the document as its parent.
+func rootElement(obj *yaml.Node) *Element {
+	el := element(obj)
+	if obj.Kind == yaml.DocumentNode && len(obj.Content) > 0 {
+		inner := element(obj.Content[0])
+		inner.parent = el
+		return inner
+	}
+	return el
+}
+
+// childElements returns Elements for each of the provided nodes, using parent
+// as their parent.
+func childElements(parent *Element, nodes ...*yaml.Node) []*Element {
+	els := make([]*Element, 0, len(nodes))
+	for _, n := range nodes {
+		el := element(n)
+		el.parent = parent
+		els = append(els, el)
+	}
+	return els
+}
+
+func applyPathKey(t pathKey, obj *yaml.Node, opts MatchOptions) (*yaml.Node, bool) {
+	if obj.Kind != yaml.MappingNode {
+		return nil, false
+	}
+	pairs := mappingPairs(obj)
+	// Keys matching exactly take precedence over the ones matched through
+	// opts.
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i].Value == string(t) {
+			return pairs[i+1], true
 		}
-	} else if obj.Kind == yaml.MappingNode {
-		takeNext := false
-		for i, v := range obj.Content {
-			if takeNext {
-				return v, true
-			}
-			if i % 2 != 0 {
-				continue
-			}
-			if v.Value == string(t) {
-				takeNext = true
-			}
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if opts.keyMatches(pairs[i].Value, string(t)) {
+			return pairs[i+1], true
 		}
 	}
 	return nil, false
 }
 
-func applyPathSelector(sel pathSelector, obj *yaml.Node) (*yaml.Node, bool) {
-	if obj.Kind == yaml.DocumentNode {
-		for _, v := range obj.Content {
-			if n, ok := applyPathSelector(sel, v); ok {
-				return n, ok
-			}
+// applyPathSelector returns all items of a sequence node, or all values of a
+// mapping node, matching the provided selector.
+func applyPathSelector(sel pathSelector, obj *yaml.Node, opts MatchOptions) []*yaml.Node {
+	var result []*yaml.Node
+	for _, v := range applyPathWildcard(obj) {
+		if sel.matches(v, opts) {
+			result = append(result, v)
 		}
-	} else if obj.Kind == yaml.SequenceNode {
-		for _, v := range obj.Content {
-			if selRes, ok := applyPathKey(pathKey(sel.Key), v); ok {
-				if selRes.Value == sel.Value {
-					return v, ok
-				}
-			}
+	}
+
+	return result
+}
+
+func applyPathIndex(idx pathIndex, obj *yaml.Node) (*yaml.Node, bool) {
+	switch obj.Kind {
+	case yaml.SequenceNode:
+		i := int(idx)
+		if i < 0 {
+			i += len(obj.Content)
 		}
+		if i >= 0 && i < len(obj.Content) {
+			return obj.Content[i], true
+		}
+	case yaml.MappingNode:
+		// Numeric components may also refer to regular mapping keys.
+		return applyPathKey(pathKey(strconv.Itoa(int(idx))), obj, MatchOptions{})
+	}
+	return nil, false
+}
+
+func applyPathSlice(sl pathSlice, obj *yaml.Node) []*yaml.Node {
+	if obj.Kind != yaml.SequenceNode {
+		return nil
 	}
+	start, end := sl.bounds(len(obj.Content))
+	if start >= end {
+		return nil
+	}
+	return obj.Content[start:end]
+}
 
+// applyPathWildcard returns all values of a mapping node, or all items of a
+// sequence node.
+func applyPathWildcard(obj *yaml.Node) []*yaml.Node {
+	switch obj.Kind {
+	case yaml.SequenceNode:
+		return obj.Content
+	case yaml.MappingNode:
+		pairs := mappingPairs(obj)
+		values := make([]*yaml.Node, 0, len(pairs)/2)
+		for i := 1; i < len(pairs); i += 2 {
+			values = append(values, pairs[i])
+		}
+		return values
+	}
+	return nil
+}
+
+// descendants returns the provided element followed by all of its descendant
+// values, in document order. expanding holds the nodes being visited, so
+// values containing themselves through aliases are only visited once.
+func descendants(el *Element, expanding map[*yaml.Node]bool) []*Element {
+	result := []*Element{el}
+	if !el.expand(expanding) {
+		return result
+	}
+	defer delete(expanding, el.node())
+	for _, child := range childElements(el, applyPathWildcard(el.node())...) {
+		result = append(result, descendants(child, expanding)...)
+	}
+	return result
+}
+
+// documentOrder removes duplicated elements from the provided list, and sorts
+// the remaining ones according to their position in the document.
+func documentOrder(els []*Element) []*Element {
+	if len(els) == 0 {
+		return els
+	}
+	return positionOrder(els, nodePositions(findRoot(els[0])))
+}
+
+// nodePositions returns the position of each node under root, in document
+// order.
+func nodePositions(root *yaml.Node) map[*yaml.Node]int {
+	positions := map[*yaml.Node]int{}
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if _, ok := positions[n]; ok {
+			return
+		}
+		positions[n] = len(positions)
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(root)
+	return positions
+}
+
+// positionOrder works just like documentOrder, but takes the positions
+// obtained through nodePositions.
+func positionOrder(els []*Element, positions map[*yaml.Node]int) []*Element {
+	seen := map[*yaml.Node]bool{}
+	result := make([]*Element, 0, len(els))
+	for _, el := range els {
+		if seen[el.value] {
+			continue
+		}
+		seen[el.value] = true
+		result = append(result, el)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return positions[result[i].value] < positions[result[j].value]
+	})
+	return result
+}
+
+// applyComponent applies a single path component to the provided element,
+// returning all matching elements.
+func applyComponent(component interface{}, el *Element, opts MatchOptions) []*Element {
+	obj := el.node()
+	switch t := component.(type) {
+	case pathKey:
+		if v, ok := applyPathKey(t, obj, opts); ok {
+			return childElements(el, v)
+		}
+	case pathSelector:
+		return childElements(el, applyPathSelector(t, obj, opts)...)
+	case pathIndex:
+		if v, ok := applyPathIndex(t, obj); ok {
+			return childElements(el, v)
+		}
+	case pathSlice:
+		return childElements(el, applyPathSlice(t, obj)...)
+	case pathWildcard:
+		return childElements(el, applyPathWildcard(obj)...)
+	case pathRecursive:
+		return descendants(el, map[*yaml.Node]bool{})
+	case pathUnion:
+		var result []*Element
+		for _, b := range t.Branches {
+			result = append(result, applySearch(b, el, opts)...)
+		}
+		return result
+	case pathAppend:
+		// Positions past the end of sequences hold no items, leaving only
+		// the - key of mappings.
+		if v, ok := applyPathKey(appendToken, obj, opts); ok {
+			return childElements(el, v)
+		}
+		return nil
+	case pathParent:
+		// Parent steps stop at the document's root
+		if el.parent != nil && el.parent.value.Kind != yaml.DocumentNode {
+			return []*Element{el.parent}
+		}
+		return nil
+	case pathFunction:
+		if v, ok := applyPathFunction(t, el); ok {
+			return []*Element{element(v)}
+		}
+		return nil
+	case pathPositional:
+		matches := applyComponent(t.Base, el, opts)
+		if reorders(t.Base) {
+			matches = documentOrder(matches)
+		}
+		return t.filter(matches)
+	}
+	return nil
+}
+
+// applyPathFunction returns a new node holding the result of the provided
+// function applied to el. Returns false in case the function does not apply
+// to el.
+func applyPathFunction(fn pathFunction, el *Element) (*yaml.Node, bool) {
+	obj := el.node()
+	switch fn {
+	case funcLength:
+		var length int
+		switch {
+		case obj.Kind == yaml.SequenceNode:
+			length = len(obj.Content)
+		case obj.Kind == yaml.MappingNode:
+			length = len(mappingPairs(obj)) / 2
+		case el.Kind() == KindString:
+			length = utf8.RuneCountInString(obj.Value)
+		default:
+			return nil, false
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(length)}, true
+	case funcKeys:
+		if obj.Kind != yaml.MappingNode {
+			return nil, false
+		}
+		keys := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		pairs := mappingPairs(obj)
+		for i := 0; i < len(pairs); i += 2 {
+			keys.Content = append(keys.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: resolveAlias(pairs[i]).Value})
+		}
+		return keys, true
+	case funcType:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: el.Kind().String()}, true
+	}
 	return nil, false
 }
 
-func applySearch(path []interface{}, obj *yaml.Node) (bool, *Element) {
-	el := element(obj)
-	for _, v := range path {
-		switch t := v.(type) {
-		case pathKey:
-			if v, ok := applyPathKey(t, obj); ok {
-				nel := element(v)
-				nel.parent = el
-				obj = v
-				el = nel
-			} else {
-				return false, nil
+// reorders returns whether the provided component may yield overlapping
+// matches, or matches out of document order.
+func reorders(component interface{}) bool {
+	switch component.(type) {
+	case pathRecursive, pathUnion, pathParent:
+		return true
+	}
+	return false
+}
+
+// filter returns the elements of the provided list located at the positions
+// selected by the receiver.
+func (p pathPositional) filter(els []*Element) []*Element {
+	if len(els) == 0 {
+		return nil
+	}
+	switch p.Pseudo {
+	case pseudoFirst:
+		return els[:1]
+	case pseudoLast:
+		return els[len(els)-1:]
+	case pseudoNth:
+		if p.N <= len(els) {
+			return els[p.N-1 : p.N]
+		}
+	case pseudoEven, pseudoOdd:
+		// Positions are 1-based, so even positions are the second,
+		// fourth, and so on.
+		var result []*Element
+		for i, el := range els {
+			if ((i+1)%2 == 0) == (p.Pseudo == pseudoEven) {
+				result = append(result, el)
 			}
-		case pathSelector:
-			if v, ok := applyPathSelector(t, obj); ok {
-				nel := element(v)
-				nel.parent = el
-				obj = v
-				el = nel
-			} else {
-				return false, nil
+		}
+		return result
+	}
+	return nil
+}
+
+func applySearch(path []interface{}, from *Element, opts MatchOptions) []*Element {
+	matches := []*Element{from}
+	reorder := false
+	// Positions are only computed once per search, as components following
+	// overlapping matches must also be reordered.
+	var positions map[*yaml.Node]int
+	for _, v := range path {
+		var next []*Element
+		for _, el := range matches {
+			next = append(next, applyComponent(v, el, opts)...)
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		if reorders(v) {
+			// Matches found through recursive descents, unions and parent
+			// steps may overlap, and are not necessarily produced in
+			// document order.
+			reorder = true
+		}
+		if reorder {
+			if positions == nil {
+				positions = nodePositions(findRoot(from))
 			}
+			next = positionOrder(next, positions)
 		}
+		matches = next
 	}
-	return true, el
+	return matches
 }
@@ -1,6 +1,8 @@
 package uyaml
 
 import (
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -127,6 +129,13 @@ func TestSet(t *testing.T) {
 	assert.Equal(t, "image:\n    repo: foo\n    test: true\n    version: \"1.0\"\n", string(b))
 }
 
+func TestSetNodeValue(t *testing.T) {
+	d, err := Decode([]byte("image:\n  repo: foo\n"))
+	require.NoError(t, err)
+	_, err = d.Set("copy", d.MustDigItem("image").value)
+	assert.Error(t, err)
+}
+
 func TestNull(t *testing.T) {
 	yaml := `image:
   list: null`
@@ -137,3 +146,1401 @@ func TestNull(t *testing.T) {
 	require.True(t, ok)
 	require.True(t, i.IsNull())
 }
+
+func TestDigIndex(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	ok, v, err := d.DigItem("users.1.name")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "lester", v.MustString())
+
+	ok, v, err = d.DigItem("users[0].roles[2]")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "bar", v.MustString())
+
+	ok, _, err = d.DigItem("users[2]")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRemoveIndex(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	obj, err := d.Remove("users.0.roles.1")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", obj)
+	ok, roles := d.MustDigItem("users.0.roles").StringSlice()
+	assert.True(t, ok)
+	assert.Equal(t, []string{"bot", "bar"}, roles)
+}
+
+func TestSetIndex(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	_, err = d.Set("users.1.roles.0", "admin")
+	require.NoError(t, err)
+	_, err = d.Set("users.1.roles.2", "bot")
+	require.NoError(t, err)
+	_, err = d.Set("users[3].name", "fred")
+	require.NoError(t, err)
+	b, err := d.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, "usersCount: 2\nusers:\n  - name: josie\n    roles:\n      - bot\n      - foo\n      - bar\n    admin: true\n    createdAt: 0\n    weight: 1.3\n  - name: lester\n    roles:\n      - admin\n      - null\n      - bot\n  - null\n  - name: fred\n", string(b))
+
+	_, err = d.Set("users.2.name", "ann")
+	require.NoError(t, err)
+	assert.Equal(t, "ann", d.MustDigItem("users.2.name").MustString())
+}
+
+func TestSetIndexOutOfRange(t *testing.T) {
+	d, err := Decode([]byte("a: [1]\n"))
+	require.NoError(t, err)
+
+	_, err = d.Set("a[20000000]", 1)
+	assert.True(t, errors.Is(err, ErrOutOfRange))
+	_, err = d.Set("b[20000000].c", 1)
+	assert.True(t, errors.Is(err, ErrOutOfRange))
+	_, err = d.Set("a[-5]", 1)
+	assert.True(t, errors.Is(err, ErrOutOfRange))
+	assert.Len(t, d.MustDigItem("a").MustSlice(), 1)
+
+	_, err = d.Set(fmt.Sprintf("a[%d]", MaxSequencePadding+1), 1)
+	require.NoError(t, err)
+	assert.Len(t, d.MustDigItem("a").MustSlice(), MaxSequencePadding+2)
+}
+
+func TestSetNestedStructure(t *testing.T) {
+	d, err := Decode([]byte("a: 1\n"))
+	require.NoError(t, err)
+	_, err = d.Set("b.c.d", 1)
+	require.NoError(t, err)
+	_, err = d.Set("e.(name='x').roles", []string{"r"})
+	require.NoError(t, err)
+	b, err := d.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, "a: 1\nb:\n    c:\n        d: 1\ne:\n  - name: x\n    roles:\n      - r\n", string(b))
+}
+
+func TestDigNegativeIndex(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	assert.Equal(t, "lester", d.MustDigItem("users[-1].name").MustString())
+	assert.Equal(t, "foo", d.MustDigItem("users.0.roles[-2]").MustString())
+
+	ok, _, err := d.DigItem("users[-3]")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSearchSlice(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+
+	names := func(path string) []string {
+		matches, err := search(path, rootElement(d.Value), MatchOptions{})
+		require.NoError(t, err)
+		var res []string
+		for _, m := range matches {
+			res = append(res, m.MustString())
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"foo", "bar"}, names("users.0.roles[1:3]"))
+	assert.Equal(t, []string{"bot", "foo"}, names("users.0.roles[:2]"))
+	assert.Equal(t, []string{"bar"}, names("users.0.roles[-1:]"))
+	assert.Equal(t, []string{"josie", "lester"}, names("users[:].name"))
+	assert.Empty(t, names("users.0.roles[2:1]"))
+}
+
+func TestRemoveSliceItems(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	matches, err := search("users.0.roles[:2]", rootElement(d.Value), MatchOptions{})
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	for _, m := range matches {
+		require.NoError(t, m.Remove())
+	}
+	b, err := matches[0].Encode()
+	require.NoError(t, err)
+	assert.Equal(t, "usersCount: 2\nusers:\n  - name: josie\n    roles:\n      - bar\n    admin: true\n    createdAt: 0\n    weight: 1.3\n  - name: lester\n    roles:\n      - dummy\n", string(b))
+}
+
+func TestSetSlice(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	_, err = d.Set("users[0:2].weight", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), d.MustDigItem("users.0.weight").MustInt())
+	ok, _, err := d.DigItem("users.1.weight")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = d.Set("users[5:].admin", false)
+	assert.Error(t, err)
+}
+
+func TestElementRemoveMappingValue(t *testing.T) {
+	d, err := Decode([]byte("a: 1\nb: 2\nc: 3\n"))
+	require.NoError(t, err)
+	require.NoError(t, d.MustDigItem("b").Remove())
+	b, err := d.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, "a: 1\nc: 3\n", string(b))
+}
+
+func TestRemoveTopLevelKey(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	obj, err := d.Remove("usersCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), obj)
+	_, err = d.Set("users.0.name", "josephine")
+	require.NoError(t, err)
+	b, err := d.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, "users:\n  - name: josephine\n    roles:\n      - bot\n      - foo\n      - bar\n    admin: true\n    createdAt: 0\n    weight: 1.3\n  - name: lester\n    roles:\n      - dummy\n", string(b))
+}
+
+func TestDigAll(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+
+	matches, err := d.DigAll("users.*.name")
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, "josie", matches[0].MustString())
+	assert.Equal(t, "lester", matches[1].MustString())
+
+	matches, err = d.DigAll("users.*.roles[*]")
+	require.NoError(t, err)
+	require.Len(t, matches, 4)
+	assert.Equal(t, "dummy", matches[3].MustString())
+
+	user := d.MustDigItem("users.0")
+	matches, err = user.DigAll("*")
+	require.NoError(t, err)
+	require.Len(t, matches, 5)
+	assert.Equal(t, "josie", matches[0].MustString())
+
+	matches, err = d.DigAll("users.*.missing")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	_, err = d.DigAll("")
+	assert.Error(t, err)
+}
+
+func TestRemoveWildcardMatches(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	matches, err := d.DigAll("users.*.roles")
+	require.NoError(t, err)
+	for _, m := range matches {
+		require.NoError(t, m.Remove())
+	}
+	b, err := d.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, "usersCount: 2\nusers:\n  - name: josie\n    admin: true\n    createdAt: 0\n    weight: 1.3\n  - name: lester\n", string(b))
+}
+
+const deploymentFile = `spec:
+  image: root
+  initContainers:
+    - name: init
+      image: busybox
+  containers:
+    - name: web
+      image: nginx
+      sidecar:
+        image: envoy
+    - name: worker
+      image: worker
+other:
+  image: unrelated
+`
+
+func TestDigRecursive(t *testing.T) {
+	d, err := Decode([]byte(deploymentFile))
+	require.NoError(t, err)
+
+	images := func(path string) []string {
+		matches, err := d.DigAll(path)
+		require.NoError(t, err)
+		var res []string
+		for _, m := range matches {
+			res = append(res, m.MustString())
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"root", "busybox", "nginx", "envoy", "worker"}, images("spec..image"))
+	assert.Equal(t, []string{"nginx", "envoy", "worker"}, images("spec.containers..image"))
+	assert.Equal(t, []string{"root", "busybox", "nginx", "envoy", "worker", "unrelated"}, images("**.image"))
+	assert.Equal(t, []string{"busybox", "nginx", "envoy", "worker"}, images("spec.**.*.image"))
+
+	matches, err := d.DigAll("spec..sidecar")
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	require.NoError(t, matches[0].Remove())
+	assert.Equal(t, []string{"root", "busybox", "nginx", "worker"}, images("spec..image"))
+}
+
+func TestDigRecursiveNestedOrder(t *testing.T) {
+	d, err := Decode([]byte("a:\n  p:\n    q:\n      x: 1\n    x: 2\n"))
+	require.NoError(t, err)
+	matches, err := d.DigAll("a..*.x")
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, int64(1), matches[0].MustInt())
+	assert.Equal(t, int64(2), matches[1].MustInt())
+}
+
+func TestSetRecursive(t *testing.T) {
+	d, err := Decode([]byte(deploymentFile))
+	require.NoError(t, err)
+	_, err = d.Set("spec.containers..image", "alpine")
+	require.NoError(t, err)
+	matches, err := d.DigAll("**.image")
+	require.NoError(t, err)
+	require.Len(t, matches, 6)
+	assert.Equal(t, "alpine", matches[2].MustString())
+	assert.Equal(t, "envoy", matches[3].MustString())
+
+	_, err = d.Set("spec..missing", "alpine")
+	assert.Error(t, err)
+}
+
+const itemsFile = `items:
+  - name: a
+    priority: 1
+    weight: 0.5
+  - name: b
+    priority: 3
+    weight: 1.5
+  - name: c
+    priority: 5
+    weight: 1
+  - name: d
+`
+
+func TestSelectorComparisons(t *testing.T) {
+	d, err := Decode([]byte(itemsFile))
+	require.NoError(t, err)
+
+	names := func(path string) []string {
+		matches, err := d.DigAll(path)
+		require.NoError(t, err)
+		var res []string
+		for _, m := range matches {
+			res = append(res, m.MustString())
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"a", "b"}, names("items.(priority<=3).name"))
+	assert.Equal(t, []string{"a"}, names("items.(priority<3).name"))
+	assert.Equal(t, []string{"b", "c"}, names("items.(priority>1).name"))
+	assert.Equal(t, []string{"b"}, names("items.(weight>1.0).name"))
+	assert.Equal(t, []string{"b", "c"}, names("items.(weight>=1).name"))
+	assert.Equal(t, []string{"c"}, names("items.(weight=1.0).name"))
+	assert.Equal(t, []string{"a", "c", "d"}, names("items.(name!='b').name"))
+	assert.Equal(t, []string{"a", "c", "d"}, names("items.(priority!=3).name"))
+	assert.Equal(t, names("items.(!(priority=3)).name"), names("items.(priority!=3).name"))
+	assert.Equal(t, []string{"a", "b", "c", "d"}, names("items.(missing!='x').name"))
+	assert.Empty(t, names("items.(missing<'x').name"))
+	assert.Equal(t, []string{"c", "d"}, names("items.(name>='c').name"))
+	assert.Empty(t, names("items.(name>3).name"))
+}
+
+func TestSetSelectorComparison(t *testing.T) {
+	d, err := Decode([]byte(itemsFile))
+	require.NoError(t, err)
+	_, err = d.Set("items.(priority>1).urgent", true)
+	require.NoError(t, err)
+	matches, err := d.DigAll("items.*.urgent")
+	require.NoError(t, err)
+	assert.Len(t, matches, 1)
+
+	_, err = d.Set("items.(priority>10).urgent", true)
+	assert.Error(t, err)
+
+	_, err = d.Set("items.(priority=7).name", "e")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), d.MustDigItem("items.(name='e').priority").MustInt())
+}
+
+func TestSelectorStringOperators(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+
+	names := func(path string) []string {
+		matches, err := d.DigAll(path)
+		require.NoError(t, err)
+		var res []string
+		for _, m := range matches {
+			res = append(res, m.MustString())
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"josie"}, names("users.(name~='^jo').name"))
+	assert.Equal(t, []string{"josie", "lester"}, names("users.(name~='[ei]$|^l').name"))
+	assert.Equal(t, []string{"lester"}, names("users.(name^='les').name"))
+	assert.Equal(t, []string{"josie"}, names("users.(name$='sie').name"))
+	assert.Equal(t, []string{"josie", "lester"}, names("users.(name*='e').name"))
+	assert.Equal(t, []string{"josie"}, names("users.(weight^='1.').name"))
+	assert.Empty(t, names("users.(roles*='bot').name"))
+}
+
+func TestSelectorBoolean(t *testing.T) {
+	d, err := Decode([]byte(itemsFile))
+	require.NoError(t, err)
+
+	names := func(path string) []string {
+		matches, err := d.DigAll(path)
+		require.NoError(t, err)
+		var res []string
+		for _, m := range matches {
+			res = append(res, m.MustString())
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"b"}, names("items.(priority>1 && weight>1).name"))
+	assert.Equal(t, []string{"a", "c"}, names("items.(name='a' || priority=5).name"))
+	assert.Equal(t, []string{"b", "c", "d"}, names("items.(!(name='a')).name"))
+	assert.Equal(t, []string{"c"}, names("items.((name='a' || name='c') && !(weight<1)).name"))
+}
+
+func TestSetSelectorBoolean(t *testing.T) {
+	d, err := Decode([]byte(itemsFile))
+	require.NoError(t, err)
+	_, err = d.Set("items.(name='e' && priority=2).weight", 0.25)
+	require.NoError(t, err)
+	item := d.MustDigItem("items.(name='e')")
+	assert.Equal(t, int64(2), item.MustDig("priority").MustInt())
+	assert.Equal(t, 0.25, item.MustDig("weight").MustFloat())
+
+	_, err = d.Set("items.(name='f' || name='g').weight", 1)
+	assert.Error(t, err)
+	_, err = d.Set("items.(!(name='f')).extra", 1)
+	require.NoError(t, err)
+	matches, err := d.DigAll("items.*.extra")
+	require.NoError(t, err)
+	assert.Len(t, matches, 1)
+}
+
+const servicesFile = `services:
+  - name: a
+    port: 8080
+    enabled: yes
+  - name: b
+    port: '8080'
+    enabled: true
+  - name: c
+    port: 8080.0
+    enabled: off
+    extra: null
+  - name: d
+    enabled: "yes"
+    extra: ~
+`
+
+func TestSelectorTypedLiterals(t *testing.T) {
+	d, err := Decode([]byte(servicesFile))
+	require.NoError(t, err)
+
+	names := func(path string) []string {
+		matches, err := d.DigAll(path)
+		require.NoError(t, err)
+		var res []string
+		for _, m := range matches {
+			res = append(res, m.MustString())
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"a", "c"}, names("services.(port=8080).name"))
+	assert.Equal(t, []string{"a", "b"}, names("services.(port='8080').name"))
+	assert.Equal(t, []string{"a", "b"}, names("services.(enabled=true).name"))
+	assert.Equal(t, []string{"c"}, names("services.(enabled=false).name"))
+	assert.Equal(t, []string{"c", "d"}, names("services.(enabled!=true).name"))
+	assert.Equal(t, []string{"c", "d"}, names("services.(extra=null).name"))
+}
+
+func TestSetSelectorTypedLiterals(t *testing.T) {
+	d, err := Decode([]byte("services:\n  - name: a\n"))
+	require.NoError(t, err)
+	_, err = d.Set("services.(name='e' && enabled=true && port=9000 && extra=null).weight", 1.5)
+	require.NoError(t, err)
+	item := d.MustDigItem("services.(name='e')")
+	assert.Equal(t, KindBool, item.MustDig("enabled").Kind())
+	assert.Equal(t, KindInt, item.MustDig("port").Kind())
+	assert.Equal(t, KindNull, item.MustDig("extra").Kind())
+	assert.Equal(t, 1.5, item.MustDig("weight").MustFloat())
+}
+
+func TestSelectorExistence(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+
+	ok, v, err := d.DigItem("users.(admin).name")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "josie", v.MustString())
+
+	ok, v, err = d.DigItem("users.(!admin).name")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "lester", v.MustString())
+
+	matches, err := d.DigAll("users.(roles).name")
+	require.NoError(t, err)
+	assert.Len(t, matches, 2)
+
+	ok, _, err = d.DigItem("users.(missing)")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSetSelectorExistence(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	_, err = d.Set("users.(!admin).admin", false)
+	require.NoError(t, err)
+	assert.False(t, d.MustDigItem("users.1.admin").MustBool())
+
+	_, err = d.Set("users.(manager).name", "boss")
+	assert.Error(t, err)
+	_, err = d.Set("users.(name='boss' && manager).name", "boss")
+	assert.Error(t, err)
+	assert.Len(t, d.MustDigItem("users").MustSlice(), 2)
+}
+
+const manifestsFile = `items:
+  - metadata:
+      name: web
+      labels:
+        tier: frontend
+    spec:
+      replicas: 3
+      containers:
+        - image: nginx
+  - metadata:
+      name: db
+    spec:
+      replicas: 1
+      containers:
+        - image: postgres
+        - image: pgbouncer
+`
+
+func TestSelectorNestedKeys(t *testing.T) {
+	d, err := Decode([]byte(manifestsFile))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(3), d.MustDigItem("items.(metadata.name='web').spec.replicas").MustInt())
+	assert.Equal(t, int64(1), d.MustDigItem("items.(metadata.name!='web').spec.replicas").MustInt())
+	assert.Equal(t, "db", d.MustDigItem("items.(spec.containers.*.image='pgbouncer').metadata.name").MustString())
+	assert.Equal(t, "web", d.MustDigItem("items.(metadata.labels).metadata.name").MustString())
+	assert.Equal(t, "db", d.MustDigItem("items.(spec.containers[1]).metadata.name").MustString())
+
+	ok, _, err := d.DigItem("items.(metadata.name.first='web')")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSetSelectorNestedKeys(t *testing.T) {
+	d, err := Decode([]byte(manifestsFile))
+	require.NoError(t, err)
+
+	_, err = d.Set("items.(metadata.name='db').spec.replicas", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), d.MustDigItem("items.1.spec.replicas").MustInt())
+
+	_, err = d.Set("items.(metadata.name='cache' && metadata.labels.tier='backend').spec.replicas", 1)
+	require.NoError(t, err)
+	item := d.MustDigItem("items.2")
+	assert.Equal(t, "cache", item.MustDig("metadata.name").MustString())
+	assert.Equal(t, "backend", item.MustDig("metadata.labels.tier").MustString())
+	assert.Equal(t, int64(1), item.MustDig("spec.replicas").MustInt())
+
+	_, err = d.Set("items.(metadata.name='queue').metadata.labels.tier", "backend")
+	require.NoError(t, err)
+	item = d.MustDigItem("items.(metadata.name='queue')")
+	assert.Equal(t, "backend", item.MustDig("metadata.labels.tier").MustString())
+
+	_, err = d.Set("items.(metadata.name='zed')", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "other"},
+	})
+	assert.Error(t, err)
+
+	value := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "zed", "namespace": "apps"},
+	}
+	for i := 0; i < 2; i++ {
+		_, err = d.Set("items.(metadata.name='zed')", value)
+		require.NoError(t, err)
+	}
+	matches, err := d.DigAll("items.(metadata.name='zed')")
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	assert.Equal(t, "apps", matches[0].MustDig("metadata.namespace").MustString())
+}
+
+func TestSelectorSelf(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+
+	assert.Equal(t, "bot", d.MustDigItem("users.0.roles.(.='bot')").MustString())
+	assert.Equal(t, "lester", d.MustDigItem("users.(roles[*]='dummy').name").MustString())
+
+	matches, err := d.DigAll("users.*.roles.(. ^= 'b')")
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, "bot", matches[0].MustString())
+	assert.Equal(t, "bar", matches[1].MustString())
+
+	_, err = d.Remove("users.(name='josie').roles.(.='bot')")
+	require.NoError(t, err)
+	_, roles := d.MustDigItem("users.0.roles").StringSlice()
+	assert.Equal(t, []string{"foo", "bar"}, roles)
+
+	_, err = d.MustDigItem("users.0.roles.(.='foo')").Replace("baz")
+	require.NoError(t, err)
+	_, roles = d.MustDigItem("users.0.roles").StringSlice()
+	assert.Equal(t, []string{"baz", "bar"}, roles)
+}
+
+func TestSetSelectorSelf(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+
+	_, err = d.Set("users.(name='lester').roles.(.='bot')", "bot")
+	require.NoError(t, err)
+	_, roles := d.MustDigItem("users.1.roles").StringSlice()
+	assert.Equal(t, []string{"dummy", "bot"}, roles)
+
+	_, err = d.Set("users.(name='lester').roles.(.='bot')", "bot")
+	require.NoError(t, err)
+	_, roles = d.MustDigItem("users.1.roles").StringSlice()
+	assert.Equal(t, []string{"dummy", "bot"}, roles)
+
+	_, err = d.Set("users.(name='new').roles.(.='admin')", "admin")
+	require.NoError(t, err)
+	_, roles = d.MustDigItem("users.(name='new').roles").StringSlice()
+	assert.Equal(t, []string{"admin"}, roles)
+
+	_, err = d.Set("users.0.roles.(.='x' && .!='y')", "x")
+	assert.Error(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = d.Set("users.0.roles.(.='admin')", "robot")
+		assert.Error(t, err)
+	}
+	_, roles = d.MustDigItem("users.0.roles").StringSlice()
+	assert.Equal(t, []string{"bot", "foo", "bar"}, roles)
+
+	_, err = d.Set("users.0.roles.(.='admin')", nil)
+	require.NoError(t, err)
+	_, roles = d.MustDigItem("users.0.roles").StringSlice()
+	assert.Equal(t, []string{"bot", "foo", "bar", "admin"}, roles)
+}
+
+const servicesMapFile = `services:
+  web:
+    replicas: 3
+    image: nginx
+  db:
+    replicas: 1
+    image: postgres
+  cache:
+    replicas: 2
+    image: redis
+`
+
+func TestSelectorMapping(t *testing.T) {
+	d, err := Decode([]byte(servicesMapFile))
+	require.NoError(t, err)
+
+	matches, err := d.DigAll("services.(replicas>1)")
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	var keys []string
+	for _, m := range matches {
+		ok, k := m.Key()
+		require.True(t, ok)
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []string{"web", "cache"}, keys)
+
+	assert.Equal(t, "postgres", d.MustDigItem("services.(replicas=1).image").MustString())
+
+	ok, k := d.MustDigItem("services.web.replicas").Key()
+	assert.True(t, ok)
+	assert.Equal(t, "replicas", k)
+
+	d, err = Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	ok, _ = d.MustDigItem("users.0").Key()
+	assert.False(t, ok)
+}
+
+func TestRemoveSelectorMapping(t *testing.T) {
+	d, err := Decode([]byte(servicesMapFile))
+	require.NoError(t, err)
+
+	_, err = d.Remove("services.(image='postgres')")
+	require.NoError(t, err)
+	_, m := d.MustDigItem("services").Map()
+	assert.Len(t, m, 2)
+	assert.NotContains(t, m, "db")
+
+	_, err = d.Set("services.(image='redis').replicas", 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), d.MustDigItem("services.cache.replicas").MustInt())
+
+	_, err = d.Set("services.(image='mysql').replicas", 1)
+	assert.Error(t, err)
+}
+
+func TestQuotedKeys(t *testing.T) {
+	d, err := Decode([]byte(`metadata:
+  labels:
+    app.kubernetes.io/name: web
+data:
+  config.yaml: "port: 80"
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "web", d.MustDigItem("metadata.labels.'app.kubernetes.io/name'").MustString())
+	assert.Equal(t, "web", d.MustDigItem(`metadata.labels["app.kubernetes.io/name"]`).MustString())
+	assert.Equal(t, "port: 80", d.MustDigItem("data."+EscapeKey("config.yaml")).MustString())
+
+	_, err = d.Set("metadata.labels."+EscapeKey("app.kubernetes.io/part-of"), "shop")
+	require.NoError(t, err)
+	assert.Equal(t, "shop", d.MustDigItem(`metadata.labels.app\.kubernetes\.io/part-of`).MustString())
+}
+
+func TestCompilePath(t *testing.T) {
+	_, err := CompilePath("users.(name=")
+	assert.Error(t, err)
+	assert.Panics(t, func() { MustCompilePath("") })
+
+	name := MustCompilePath("users.(admin=true).name")
+	assert.Equal(t, "users.(admin=true).name", name.String())
+	for i := 0; i < 3; i++ {
+		d, err := Decode([]byte(yamlFile))
+		require.NoError(t, err)
+		ok, v, err := d.DigPath(name)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, "josie", v.MustString())
+	}
+
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	roles := MustCompilePath("roles[*]")
+	matches, err := d.MustDigItem("users.0").DigAllPath(roles)
+	require.NoError(t, err)
+	assert.Len(t, matches, 3)
+	assert.Equal(t, "dummy", d.MustDigItem("users.1").MustDigPath(roles).MustString())
+
+	_, err = d.SetPath(MustCompilePath("users.(name='lester').admin"), true)
+	require.NoError(t, err)
+	assert.True(t, d.MustDigPath(MustCompilePath("users.1.admin")).MustBool())
+
+	removed, err := d.RemovePath(MustCompilePath("users.(name='lester')"))
+	require.NoError(t, err)
+	assert.Equal(t, "lester", removed.(map[string]interface{})["name"])
+	_, err = d.RemovePath(MustCompilePath("users.(name='lester')"))
+	assert.Error(t, err)
+
+	var zero Path
+	_, _, err = d.DigPath(zero)
+	assert.Error(t, err)
+	_, err = d.SetPath(zero, 1)
+	assert.Error(t, err)
+	_, err = d.RemovePath(zero)
+	assert.Error(t, err)
+}
+
+func TestPathBuilder(t *testing.T) {
+	cases := map[string]*PathBuilder{
+		"users.(name='josie').roles":             NewPath().Key("users").Where("name", "josie").Key("roles"),
+		`users.(name='it\'s.me').'a.b'`:          NewPath().Key("users").Where("name", "it's.me").Key("a.b"),
+		"users[0].roles[-1]":                     NewPath().Key("users").Index(0).Key("roles").Index(-1),
+		"users[1:3].roles[1:][:2]":               NewPath().Key("users").Slice(1, 3).Key("roles").SliceFrom(1).SliceTo(2),
+		"**.users.*.name":                        NewPath().Recursive().Key("users").Wildcard().Key("name"),
+		"users.(admin=true && weight>=1.0)":      NewPath().Key("users").Match(And(Eq(Field{"admin"}, true), Ge(Field{"weight"}, 1.0))),
+		"items.(metadata.'app.io/name'^='web')":  NewPath().Key("items").Match(HasPrefix(Field{"metadata", "app.io/name"}, "web")),
+		"roles.(.='bot' || !(.~='^d'))":          NewPath().Key("roles").Match(Or(Eq(nil, "bot"), Not(Matches(Field{}, "^d")))),
+		"users.((a || b) && c!=null)":            NewPath().Key("users").Match(And(Or(Exists(Field{"a"}), Exists(Field{"b"})), Ne(Field{"c"}, nil))),
+		"users.(n<2 && n<=2 && n>1.5 && s$='x')": NewPath().Key("users").Match(And(Lt(Field{"n"}, 2), Le(Field{"n"}, int64(2)), Gt(Field{"n"}, float32(1.5)), HasSuffix(Field{"s"}, "x"))),
+		"users.(s*='x')":                         NewPath().Key("users").Match(Contains(Field{"s"}, "x")),
+	}
+	for expected, b := range cases {
+		assert.Equal(t, expected, b.String())
+		_, err := b.Build()
+		assert.NoError(t, err, expected)
+	}
+
+	_, err := NewPath().Key("users").Where("weight", []int{1}).Build()
+	assert.Error(t, err)
+	_, err = NewPath().Key("users").Match(Or()).Build()
+	assert.Error(t, err)
+	_, err = NewPath().Build()
+	assert.Error(t, err)
+	_, err = NewPath().Key("a").Union().Build()
+	assert.Error(t, err)
+	_, err = NewPath().Key("a").Nth(0).Build()
+	assert.Error(t, err)
+
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	name := "lester"
+	roles := NewPath().Key("users").Where("name", name).Key("roles").MustBuild()
+	_, slice := d.MustDigPath(roles).StringSlice()
+	assert.Equal(t, []string{"dummy"}, slice)
+	_, err = d.SetPath(NewPath().Key("users").Where("name", "o'brien").Key("admin").MustBuild(), true)
+	require.NoError(t, err)
+	assert.Equal(t, "o'brien", d.MustDigItem("users.2.name").MustString())
+}
+
+func TestErrors(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+
+	_, _, err = d.DigItem("")
+	assert.True(t, errors.Is(err, ErrEmptyPath))
+	_, err = d.DigAll("")
+	assert.True(t, errors.Is(err, ErrEmptyPath))
+	_, err = d.Set("", 1)
+	assert.True(t, errors.Is(err, ErrEmptyPath))
+	_, err = d.Remove("")
+	assert.True(t, errors.Is(err, ErrEmptyPath))
+	_, err = CompilePath("")
+	assert.True(t, errors.Is(err, ErrEmptyPath))
+	_, err = d.SetPath(Path{}, 1)
+	assert.True(t, errors.Is(err, ErrEmptyPath))
+
+	_, err = d.Remove("users.(name='nobody')")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = d.Set("**.nobody", 1)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	err = element(d.Value).Remove()
+	assert.True(t, errors.Is(err, ErrUnsupportedParent))
+	_, err = element(d.Value).Replace(1)
+	assert.True(t, errors.Is(err, ErrUnsupportedParent))
+
+	_, err = d.Set("users.0.name.first", "josie")
+	var mismatch *TypeMismatchError
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, &TypeMismatchError{Path: "users[0].name", Expected: KindMap, Actual: KindString}, mismatch)
+	assert.Equal(t, "expected Map at users[0].name, found String", err.Error())
+	_, err = d.Set("users.0.weight[1]", 2)
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, &TypeMismatchError{Path: "users[0].weight", Expected: KindSlice, Actual: KindFloat}, mismatch)
+	_, err = d.Set("users.name", "x")
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, "users", mismatch.Path)
+	assert.Equal(t, KindMap, mismatch.Expected)
+	_, err = d.Set("users.0.(name='x')", 1)
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, &TypeMismatchError{Path: "users[0]", Expected: KindSlice, Actual: KindMap}, mismatch)
+
+	recovered := func(fn func()) (err error) {
+		defer func() {
+			err, _ = recover().(error)
+		}()
+		fn()
+		return nil
+	}
+	err = recovered(func() { d.MustDigItem("users.(name='nobody')") })
+	assert.True(t, errors.Is(err, ErrNotFound))
+	err = recovered(func() { d.MustDigItem("") })
+	assert.True(t, errors.Is(err, ErrEmptyPath))
+	err = recovered(func() { d.MustSet("", 1) })
+	assert.True(t, errors.Is(err, ErrEmptyPath))
+	err = recovered(func() { d.MustRemove("users.5") })
+	assert.True(t, errors.Is(err, ErrNotFound))
+	err = recovered(func() { d.MustDigItem("users.1.roles").MustInt() })
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, &TypeMismatchError{Path: "users[1].roles", Expected: KindInt, Actual: KindSliceString}, mismatch)
+	err = recovered(func() { d.MustDigItem(`users.0`).MustDig("name").MustMap() })
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, "users[0].name", mismatch.Path)
+}
+
+func TestUnion(t *testing.T) {
+	d, err := Decode([]byte(`metadata:
+  namespace: prod
+  labels:
+    tier: web
+  name: web
+users:
+  - name: josie
+  - name: lester
+  - name: dummy
+`))
+	require.NoError(t, err)
+
+	values := func(path string) []string {
+		matches, err := d.DigAll(path)
+		require.NoError(t, err)
+		var res []string
+		for _, m := range matches {
+			res = append(res, m.MustString())
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"prod", "web"}, values("metadata.{name,namespace}"))
+	assert.Equal(t, []string{"prod", "web", "web"}, values("metadata.{name,labels.tier,namespace}"))
+	assert.Equal(t, []string{"prod"}, values("metadata.{namespace,missing}"))
+	assert.Equal(t, []string{"web"}, values("metadata.{name,name}"))
+	assert.Equal(t, []string{"josie", "dummy"}, values("users.(name='dummy'),(name='josie').name"))
+
+	removed, err := d.RemoveAll("users.(name='josie'),(name='lester')")
+	require.NoError(t, err)
+	assert.Len(t, removed, 2)
+	assert.Equal(t, []string{"dummy"}, values("users.*.name"))
+
+	removed, err = d.RemoveAll("metadata.{labels,labels.tier}")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"tier": "web"}, "web"}, removed)
+
+	_, err = d.RemoveAll("users.(name='josie')")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestRemoveAllFailure(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+	before, err := d.Encode()
+	require.NoError(t, err)
+
+	removed, err := d.RemoveAll("**")
+	assert.True(t, errors.Is(err, ErrUnsupportedParent))
+	assert.Nil(t, removed)
+	after, err := d.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+
+	d, err = Decode([]byte(mergeYAML))
+	require.NoError(t, err)
+	_, err = d.RemoveAll("job.{script,stage}")
+	assert.True(t, errors.Is(err, ErrUnsupportedParent))
+	assert.Equal(t, "rake", d.MustDigItem("job.script").MustString())
+}
+
+func TestSetUnion(t *testing.T) {
+	d, err := Decode([]byte("metadata:\n  name: web\n"))
+	require.NoError(t, err)
+
+	_, err = d.Set("metadata.{namespace,name}", "x")
+	require.NoError(t, err)
+	assert.Equal(t, "x", d.MustDigItem("metadata.name").MustString())
+	ok, _, err := d.DigItem("metadata.namespace")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = d.Set("spec.{replicas,template.replicas}", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), d.MustDigItem("spec.replicas").MustInt())
+	ok, _, err = d.DigItem("spec.template")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = d.Set("other.{[0],a}", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), d.MustDigItem("other.0").MustInt())
+}
+
+func TestPseudoSelectors(t *testing.T) {
+	d, err := Decode([]byte(`users:
+  - name: josie
+    admin: true
+    roles: [bot, foo, bar, baz]
+  - name: lester
+  - name: dummy
+    admin: true
+    roles: [dummy]
+`))
+	require.NoError(t, err)
+
+	values := func(path string) []string {
+		matches, err := d.DigAll(path)
+		require.NoError(t, err)
+		var res []string
+		for _, m := range matches {
+			res = append(res, m.MustString())
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"josie"}, values("users.(admin=true):first.name"))
+	assert.Equal(t, []string{"dummy"}, values("users.(admin=true):last.name"))
+	assert.Equal(t, []string{"dummy"}, values("users.(admin=true):nth(2).name"))
+	assert.Empty(t, values("users.(admin=true):nth(3).name"))
+	assert.Equal(t, []string{"baz"}, values("users.0.roles:last"))
+	assert.Equal(t, []string{"bot", "dummy"}, values("users.*.roles:first"))
+	assert.Equal(t, []string{"foo", "baz"}, values("users.0.roles:even"))
+	assert.Equal(t, []string{"bot", "bar"}, values("users.0.roles:odd"))
+	assert.Equal(t, []string{"bar"}, values("users.0.roles:odd:last"))
+	assert.Equal(t, []string{"lester"}, values("users:nth(2).name"))
+	assert.Equal(t, []string{"josie"}, values("users.{[2],[0]}:first.name"))
+
+	_, err = d.Set("users.(admin=true):last.name", "root")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"josie", "lester", "root"}, values("users.*.name"))
+
+	_, err = d.Remove("users.0.roles:nth(2)")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bot", "bar", "baz"}, values("users.0.roles.*"))
+}
+
+func TestFunctions(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2), d.MustDigItem("users.length()").MustInt())
+	assert.Equal(t, int64(5), d.MustDigItem("users.0.length()").MustInt())
+	assert.Equal(t, int64(5), d.MustDigItem("users.0.name.length()").MustInt())
+	_, keys := d.MustDigItem("users.0.keys()").StringSlice()
+	assert.Equal(t, []string{"name", "roles", "admin", "createdAt", "weight"}, keys)
+	_, keys = d.MustDigItem("keys()").StringSlice()
+	assert.Equal(t, []string{"usersCount", "users"}, keys)
+	assert.Equal(t, "Float", d.MustDigItem("users.0.weight.type()").MustString())
+	assert.Equal(t, "SliceString", d.MustDigItem("users.0.roles.type()").MustString())
+
+	matches, err := d.DigAll("users.*.roles.length()")
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, int64(3), matches[0].MustInt())
+	assert.Equal(t, int64(1), matches[1].MustInt())
+
+	assert.Equal(t, "josie", d.MustDigItem("users.(roles.length()>1).name").MustString())
+
+	ok, _, err := d.DigItem("users.0.admin.keys()")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = d.Set("users.length()", 3)
+	assert.True(t, errors.Is(err, ErrUnsupportedParent))
+}
+
+func TestParentStep(t *testing.T) {
+	d, err := Decode([]byte(`deployments:
+  - name: web
+    spec:
+      containers:
+        - image: nginx
+        - image: envoy
+  - name: api
+    spec:
+      containers:
+        - image: nginx
+  - name: db
+    spec:
+      containers:
+        - image: postgres
+`))
+	require.NoError(t, err)
+
+	names := func(path string) []string {
+		matches, err := d.DigAll(path)
+		require.NoError(t, err)
+		var res []string
+		for _, m := range matches {
+			res = append(res, m.MustDig("name").MustString())
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"web", "api"}, names("deployments.*.spec.containers.(image='nginx').^.^.^"))
+	assert.Equal(t, []string{"web", "api"}, names("**.(image='nginx').^.^.^"))
+	assert.Equal(t, []string{"web", "api", "db"}, names("deployments.*.spec.containers.*.^.^.^"))
+	assert.Equal(t, []string{"web"}, names("deployments.*.spec.containers.(image='envoy').^.^.^.name.^"))
+	assert.Equal(t, []string{"api"}, names("deployments.(spec.containers.*.image='nginx'):last.spec.^"))
+
+	matches, err := d.DigAll("deployments.^")
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	ok, _, err := d.DigItem("deployments.^.^")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	el := d.MustDigItem("deployments.0.spec.containers.1.^.^")
+	ok, key := el.Key()
+	assert.True(t, ok)
+	assert.Equal(t, "spec", key)
+
+	_, err = d.Remove("**.(image='postgres').^.^.^")
+	require.NoError(t, err)
+	assert.Len(t, d.MustDigItem("deployments").MustSlice(), 2)
+}
+
+const aliasYAML = `base: &base
+  image: nginx
+  ports:
+    - 80
+jobs:
+  - name: web
+    spec: *base
+  - name: api
+    spec: *base
+`
+
+func TestAliases(t *testing.T) {
+	d, err := Decode([]byte(aliasYAML))
+	require.NoError(t, err)
+
+	assert.Equal(t, "nginx", d.MustDigItem("jobs.0.spec.image").MustString())
+	assert.Equal(t, int64(80), d.MustDigItem("jobs.1.spec.ports[0]").MustInt())
+	assert.Equal(t, "web", d.MustDigItem("jobs.(spec.image='nginx').name").MustString())
+
+	spec := d.MustDigItem("jobs.0.spec")
+	assert.Equal(t, KindMap, spec.Kind())
+	ok, m := spec.Map()
+	require.True(t, ok)
+	assert.Equal(t, "nginx", m["image"])
+
+	_, v := d.MustDigItem("jobs").Interface()
+	assert.Equal(t, "nginx", v.([]interface{})[1].(map[string]interface{})["spec"].(map[string]interface{})["image"])
+
+	matches, err := d.DigAll("**.image")
+	require.NoError(t, err)
+	assert.Len(t, matches, 1)
+}
+
+func TestRemoveAllThroughAliases(t *testing.T) {
+	d, err := Decode([]byte("a: &x\n  k: 1\n  j: 2\nb: *x\n"))
+	require.NoError(t, err)
+
+	removed, err := d.RemoveAll("*.k")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(1)}, removed)
+	_, m := d.MustDigItem("b").Map()
+	assert.Equal(t, map[string]interface{}{"j": int64(2)}, m)
+
+	_, err = d.Set("*.j", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), d.MustDigItem("a.j").MustInt())
+	_, err = d.Set("**.j", 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), d.MustDigItem("b.j").MustInt())
+}
+
+func TestAliasCycle(t *testing.T) {
+	d, err := Decode([]byte(`a: &x
+  b: *x
+  c: 1
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), d.MustDigItem("a.b.b.c").MustInt())
+
+	ok, _ := d.MustDigItem("a").Map()
+	assert.False(t, ok)
+	ok, _ = d.MustDigItem("a").Interface()
+	assert.False(t, ok)
+
+	matches, err := d.DigAll("**.c")
+	require.NoError(t, err)
+	assert.Len(t, matches, 1)
+}
+
+func TestSetThroughAlias(t *testing.T) {
+	d, err := Decode([]byte(aliasYAML))
+	require.NoError(t, err)
+
+	_, err = d.Set("jobs.0.spec.image", "envoy")
+	require.NoError(t, err)
+	assert.Equal(t, "envoy", d.MustDigItem("base.image").MustString())
+	assert.Equal(t, "envoy", d.MustDigItem("jobs.1.spec.image").MustString())
+
+	d, err = Decode([]byte(aliasYAML))
+	require.NoError(t, err)
+
+	_, err = d.SetWith("jobs.0.spec.image", "envoy", SetOptions{Aliases: AliasCopy})
+	require.NoError(t, err)
+	assert.Equal(t, "envoy", d.MustDigItem("jobs.0.spec.image").MustString())
+	assert.Equal(t, "nginx", d.MustDigItem("base.image").MustString())
+	assert.Equal(t, "nginx", d.MustDigItem("jobs.1.spec.image").MustString())
+
+	_, err = d.SetWith("jobs.1.spec.ports[1]", 443, SetOptions{Aliases: AliasCopy})
+	require.NoError(t, err)
+	_, ports := d.MustDigItem("base.ports").IntSlice()
+	assert.Equal(t, []int64{80}, ports)
+	_, ports = d.MustDigItem("jobs.1.spec.ports").IntSlice()
+	assert.Equal(t, []int64{80, 443}, ports)
+
+	yam, err := d.Encode()
+	require.NoError(t, err)
+	_, err = Decode(yam)
+	require.NoError(t, err)
+}
+
+const mergeYAML = `base: &base
+  image: ruby
+  stage: test
+extra: &extra
+  stage: build
+  retries: 2
+job:
+  <<: [*base, *extra]
+  script: rake
+lint:
+  <<: *base
+  image: node
+`
+
+func TestMergeKeys(t *testing.T) {
+	d, err := Decode([]byte(mergeYAML))
+	require.NoError(t, err)
+
+	assert.Equal(t, "ruby", d.MustDigItem("job.image").MustString())
+	assert.Equal(t, "test", d.MustDigItem("job.stage").MustString())
+	assert.Equal(t, int64(2), d.MustDigItem("job.retries").MustInt())
+	assert.Equal(t, "node", d.MustDigItem("lint.image").MustString())
+
+	matches, err := d.DigAll("(stage='test')")
+	require.NoError(t, err)
+	var names []string
+	for _, m := range matches {
+		_, name := m.Key()
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"base", "job", "lint"}, names)
+
+	ok, m := d.MustDigItem("job").Map()
+	require.True(t, ok)
+	assert.Equal(t, map[string]interface{}{
+		"image":   "ruby",
+		"stage":   "test",
+		"retries": int64(2),
+		"script":  "rake",
+	}, m)
+
+	_, keys := d.MustDigItem("lint.keys()").StringSlice()
+	assert.Equal(t, []string{"stage", "image"}, keys)
+	assert.Equal(t, int64(4), d.MustDigItem("job.length()").MustInt())
+
+	el := d.MustDigItem("job.retries")
+	ok, key := el.Key()
+	assert.True(t, ok)
+	assert.Equal(t, "retries", key)
+
+	var job struct {
+		Image  string
+		Script string
+	}
+	require.NoError(t, d.MustDigItem("job").Decode(&job))
+	assert.Equal(t, "ruby", job.Image)
+	assert.Equal(t, "rake", job.Script)
+}
+
+func TestSetMergedKey(t *testing.T) {
+	d, err := Decode([]byte(mergeYAML))
+	require.NoError(t, err)
+
+	_, err = d.Set("job.image", "python")
+	require.NoError(t, err)
+	assert.Equal(t, "python", d.MustDigItem("job.image").MustString())
+	assert.Equal(t, "ruby", d.MustDigItem("base.image").MustString())
+
+	_, err = d.Remove("job.stage")
+	assert.True(t, errors.Is(err, ErrUnsupportedParent))
+}
+
+func TestSetBelowMergedKey(t *testing.T) {
+	d, err := Decode([]byte("base: &b\n  x:\n    z: 1\n    w: 2\nj:\n  <<: *b\n"))
+	require.NoError(t, err)
+
+	_, err = d.Set("j.x.z", 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), d.MustDigItem("j.x.z").MustInt())
+	assert.Equal(t, int64(2), d.MustDigItem("j.x.w").MustInt())
+	assert.Equal(t, int64(1), d.MustDigItem("base.x.z").MustInt())
+
+	_, err = d.Set("j.x.w", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), d.MustDigItem("j.x.w").MustInt())
+	assert.Equal(t, int64(2), d.MustDigItem("base.x.w").MustInt())
+
+	yam, err := d.Encode()
+	require.NoError(t, err)
+	_, err = Decode(yam)
+	require.NoError(t, err)
+}
+
+func TestResolveMerges(t *testing.T) {
+	d, err := Decode([]byte(mergeYAML))
+	require.NoError(t, err)
+
+	d.MustDigItem("job").ResolveMerges()
+	job := d.MustDigItem("job")
+	_, keys := d.MustDigItem("job.keys()").StringSlice()
+	assert.Equal(t, []string{"image", "stage", "retries", "script"}, keys)
+
+	_, err = d.Set("job.image", "python")
+	require.NoError(t, err)
+	assert.Equal(t, "ruby", d.MustDigItem("base.image").MustString())
+
+	yam, err := job.Encode()
+	require.NoError(t, err)
+	assert.NotContains(t, string(yam), "<<: [*base, *extra]")
+}
+
+func TestMatchOptions(t *testing.T) {
+	d, err := Decode([]byte(`Name: web
+spec:
+  max_retries: 3
+  HTTPServer:
+    Port: 80
+  containers:
+    - Image: nginx
+    - image: envoy
+`))
+	require.NoError(t, err)
+
+	ok, _, err := d.DigItem("name")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	opts := MatchOptions{CaseInsensitive: true}
+	ok, el, err := d.DigItemWith("name", opts)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "web", el.MustString())
+
+	ok, _, err = d.DigItemWith("spec.maxRetries", opts)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	matches, err := d.DigAll("spec.containers.(image='nginx')")
+	require.NoError(t, err)
+	assert.Len(t, matches, 0)
+	matches, err = d.DigAllWith("spec.containers.(image='nginx')", opts)
+	require.NoError(t, err)
+	assert.Len(t, matches, 1)
+	matches, err = d.DigAllWith("spec.containers.(image).image", opts)
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, "nginx", matches[0].MustString())
+
+	opts = MatchOptions{Normalize: SnakeAndCamel}
+	ok, el, err = d.DigItemWith("spec.maxRetries", opts)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(3), el.MustInt())
+	assert.Equal(t, int64(80), d.MustDigItem("spec.HTTPServer.Port").MustInt())
+	ok, el, err = d.DigItemWith("spec.http_server.port", opts)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(80), el.MustInt())
+
+	_, _, err = d.DigItemWith("", opts)
+	assert.True(t, errors.Is(err, ErrEmptyPath))
+
+	d, err = Decode([]byte("Name: a\nname: b\n"))
+	require.NoError(t, err)
+	ok, el, err = d.DigItemWith("name", MatchOptions{CaseInsensitive: true})
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "b", el.MustString())
+}
+
+func TestSnakeCase(t *testing.T) {
+	for key, expected := range map[string]string{
+		"maxRetries":  "max_retries",
+		"max_retries": "max_retries",
+		"MaxRetries":  "max_retries",
+		"HTTPServer":  "http_server",
+		"retry2Times": "retry2_times",
+		"NAME":        "name",
+	} {
+		assert.Equal(t, expected, snakeCase(key), key)
+	}
+}
+
+func TestPointers(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+
+	ok, el, err := d.DigPointer("/users/0/roles/1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "foo", el.MustString())
+
+	ok, el, err = d.DigPointer("")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, KindMap, el.Kind())
+
+	ok, _, err = d.DigPointer("/users/2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = d.DigPointer("users")
+	var syntaxErr *PathSyntaxError
+	assert.True(t, errors.As(err, &syntaxErr))
+
+	_, err = d.SetPointer("/users/1/roles/1", "bot")
+	require.NoError(t, err)
+	_, roles := d.MustDigItem("users[1].roles").StringSlice()
+	assert.Equal(t, []string{"dummy", "bot"}, roles)
+
+	_, err = d.SetPointer("/users/0/a~1b", true)
+	require.NoError(t, err)
+	assert.True(t, d.MustDigItem(`users[0].'a/b'`).MustBool())
+
+	removed, err := d.RemovePointer("/users/0/roles/0")
+	require.NoError(t, err)
+	assert.Equal(t, "bot", removed)
+
+	_, err = d.RemovePointer("")
+	assert.True(t, errors.Is(err, ErrEmptyPath))
+
+	_, err = d.SetPointer("/users/20000000", 1)
+	assert.True(t, errors.Is(err, ErrOutOfRange))
+	assert.Len(t, d.MustDigItem("users").MustSlice(), 2)
+}
+
+func TestPointerAppend(t *testing.T) {
+	d, err := Decode([]byte(yamlFile))
+	require.NoError(t, err)
+
+	ok, _, err := d.DigPointer("/users/-")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = d.SetPointer("/users/1/roles/-", "bot")
+	require.NoError(t, err)
+	_, roles := d.MustDigItem("users[1].roles").StringSlice()
+	assert.Equal(t, []string{"dummy", "bot"}, roles)
+
+	_, err = d.SetPointer("/users/-/name", "fred")
+	require.NoError(t, err)
+	assert.Equal(t, "fred", d.MustDigItem("users[2].name").MustString())
+
+	_, err = d.Set("labels.app", "web")
+	require.NoError(t, err)
+	_, err = d.SetPointer("/labels/-", "x")
+	require.NoError(t, err)
+	ok, el, err := d.DigPointer("/labels/-")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "x", el.MustString())
+
+	_, err = d.SetPointer("/tags/-", "a")
+	require.NoError(t, err)
+	_, tags := d.MustDigItem("tags").StringSlice()
+	assert.Equal(t, []string{"a"}, tags)
+}